@@ -0,0 +1,241 @@
+package evmdis
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Where the values of the program are used, for inferring their types
+type typeInference struct {
+	uses            map[string][]*Statement // Folded operations have no output
+	casts           map[string][]string
+}
+
+func variableLabel(expression Expression) (string, bool) {
+	switch expression := expression.(type) {
+	case Variable:
+		return expression.Label, true
+	case *Variable:
+		return expression.Label, true
+	}
+	return "", false
+}
+
+func (t *typeInference) add(op OpCode, inputs []Expression, output *Variable) {
+	statement := &Statement{Op: op, Inputs: inputs, Output: output}
+	for _, input := range inputs {
+		if cast, ok := input.(*Cast); ok {
+			if label, ok := variableLabel(cast.Value); ok {
+				t.casts[label] = append(t.casts[label], cast.Type)
+			}
+			input = cast.Value
+		}
+		if label, ok := variableLabel(input); ok {
+			t.uses[label] = append(t.uses[label], statement)
+		}
+		if location, ok := input.(*StorageLocation); ok {
+			t.add(op, location.Keys, nil)
+		}
+		if encoding, ok := input.(*Encoding); ok {
+			t.add(op, encoding.Values, nil)
+		}
+		if operation, ok := input.(*Operation); ok {
+			t.add(operation.Op, operation.Inputs, nil)
+		}
+	}
+}
+
+func (ssa *SSAProgram) typeInference() *typeInference {
+	t := &typeInference{
+		uses:  make(map[string][]*Statement),
+		casts: make(map[string][]string),
+	}
+	for _, block := range ssa.Blocks {
+		for _, statement := range block.Statements {
+			t.add(statement.Op, statement.Inputs, statement.Output)
+		}
+	}
+	return t
+}
+
+// The statements using the output of the statement with the opcode
+func (t *typeInference) usesOf(statement *Statement, op OpCode) []*Statement {
+	uses := make([]*Statement, 0)
+	if statement.Output == nil {
+		return uses
+	}
+	for _, use := range t.uses[statement.Output.Label] {
+		if use.Op == op {
+			uses = append(uses, use)
+		}
+	}
+	return uses
+}
+
+// Returns n if the value masks the highest n bytes, as for bytesN values
+func highMaskBytes(value *big.Int) (int, bool) {
+	zeros := value.TrailingZeroBits()
+	bits := 256 - int(zeros)
+	if value.BitLen() != 256 || bits % 8 != 0 || bits == 256 ||
+		new(big.Int).Rsh(value, zeros).Cmp(lowMask(uint(bits))) != 0 {
+		return 0, false
+	}
+	return bits / 8, true
+}
+
+// Returns true if the value is multiplied by the size of a word, as the
+// length of an array
+func (t *typeInference) isArrayLength(value Expression) bool {
+	label, ok := variableLabel(value)
+	if !ok {
+		return false
+	}
+	for _, use := range t.uses[label] {
+		switch {
+		case use.Op == MUL && (isConstant(use.Inputs[0], 0x20) || isConstant(use.Inputs[1], 0x20)):
+			return true
+		case use.Op == SHL && isConstant(use.Inputs[0], 5):
+			return true
+		}
+	}
+	return false
+}
+
+// The ABI type of a word of call data: masks to 160 bits are addresses,
+// double negations booleans, sign extensions signed integers and masks of
+// the highest bytes fixed size byte arrays. Words used as an offset into
+// the call data are dynamic, arrays if their length is multiplied by the
+// size of a word.
+func (t *typeInference) argumentType(argument Expression) string {
+	label, ok := variableLabel(argument)
+	if !ok {
+		return "uint256"
+	}
+	if casts := t.casts[label]; len(casts) > 0 {
+		return casts[0]
+	}
+	for _, use := range t.uses[label] {
+		switch use.Op {
+		case ISZERO:
+			if len(t.usesOf(use, ISZERO)) > 0 {
+				return "bool"
+			}
+		case AND:
+			for _, input := range use.Inputs {
+				if c, ok := input.(Constant); ok {
+					if n, ok := highMaskBytes(c.Value); ok {
+						return fmt.Sprintf("bytes%v", n)
+					}
+				}
+			}
+		case ADD:
+			if !isConstant(use.Inputs[0], 4) && !isConstant(use.Inputs[1], 4) {
+				continue
+			}
+			for _, length := range t.usesOf(use, CALLDATALOAD) {
+				if t.isArrayLength(length.Output) {
+					return "uint256[]"
+				}
+				return "bytes"
+			}
+		}
+	}
+	return "uint256"
+}
+
+// Infers the argument types of the public functions from how the call data
+// words are used. Must run after Simplify, which turns masks into casts,
+// and before EliminateDeadCode, which removes the double negations that
+// conditions no longer use.
+func (ssa *SSAProgram) InferArgumentTypes() {
+	t := ssa.typeInference()
+	for _, function := range ssa.PublicFunctions {
+		function.Types = make([]string, 0)
+		if function.Kind != PublicFunctionKind || function.Skip > 0 {
+			continue
+		}
+		for _, input := range function.Entry.Inputs {
+			function.Types = append(function.Types, t.argumentType(input))
+		}
+	}
+}
+
+// The fallback and receive functions in the ABI JSON format, which have
+// no parameters
+type abiSpecialFunction struct {
+	Type            string         `json:"type"`
+	StateMutability string         `json:"stateMutability"`
+}
+
+// An event in the ABI JSON format, every parameter is marked indexed or
+// not
+type abiEvent struct {
+	Type            string              `json:"type"`
+	Name            string              `json:"name"`
+	Inputs          []abiEventParameter `json:"inputs"`
+	Anonymous       bool                `json:"anonymous"`
+}
+
+type abiEventParameter struct {
+	Name            string         `json:"name"`
+	Type            string         `json:"type"`
+	Indexed         bool           `json:"indexed"`
+}
+
+// The recovered interface of the contract in the JSON format of solc,
+// functions and events
+func (ssa *SSAProgram) ABI() string {
+	entries := make([]interface{}, 0)
+	for _, function := range ssa.PublicFunctions {
+		mutability := "nonpayable"
+		if function.Payable {
+			mutability = "payable"
+		}
+		switch function.Kind {
+		case FallbackFunctionKind:
+			entries = append(entries, abiSpecialFunction{Type: "fallback", StateMutability: mutability})
+		case ReceiveFunctionKind:
+			entries = append(entries, abiSpecialFunction{Type: "receive", StateMutability: mutability})
+		default:
+			entry := abiEntry{
+				Type:            "function",
+				Name:            function.Name(),
+				Inputs:          make([]abiParameter, 0),
+				Outputs:         make([]abiParameter, 0),
+				StateMutability: mutability,
+			}
+			for i, argumentType := range function.argumentTypes() {
+				entry.Inputs = append(entry.Inputs, abiParameter{
+					Name: fmt.Sprintf("%v", function.Entry.Inputs[i]),
+					Type: argumentType,
+				})
+			}
+			for _, returnType := range function.ReturnTypes {
+				entry.Outputs = append(entry.Outputs, abiParameter{Type: returnType})
+			}
+			entries = append(entries, entry)
+		}
+	}
+	
+	// Events recovered from their topic are not anonymous
+	for _, event := range ssa.Events {
+		entry := abiEvent{
+			Type:   "event",
+			Name:   event.Name(),
+			Inputs: make([]abiEventParameter, 0),
+		}
+		for i, parameterType := range event.Types {
+			entry.Inputs = append(entry.Inputs, abiEventParameter{
+				Type:    parameterType,
+				Indexed: event.Indexed[i],
+			})
+		}
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
@@ -0,0 +1,117 @@
+package evmdis
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// A dispatcher of solc 0.4 for transfer(address,uint256) that checks the
+// call value, the body follows at 0x3A
+const dispatcher = "60606040527c0100000000000000000000000000000000000000000000000000000000" +
+	"600035048063a9059cbb14610035576002565b34600257"
+
+func TestInferArgumentTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"uint256", "600435600055" + "00", "uint256"},
+		{"address", "60043573ffffffffffffffffffffffffffffffffffffffff16600055" + "00", "address"},
+		{"bool", "6004351515600055" + "00", "bool"},
+		{"bool condition", "600435151560435700" + "5b00", "bool"},
+		{"bytes4", "6004357fffffffff00000000000000000000000000000000000000000000000000000000" +
+			"16600055" + "00", "bytes4"},
+		{"int8", "60043560000b600055" + "00", "int8"},
+		{"bytes", "60043560040135600055" + "00", "bytes"},
+		{"uint256[]", "60043560040135602002600055" + "00", "uint256[]"},
+	}
+	for _, test := range tests {
+		ssa := recoverContract(t, dispatcher + test.body)
+		if len(ssa.PublicFunctions) != 1 {
+			t.Fatalf("%v: expected one function, got %v", test.name, len(ssa.PublicFunctions))
+		}
+		types := ssa.PublicFunctions[0].Types
+		if len(types) != 1 || types[0] != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, types)
+		}
+	}
+}
+
+func TestABIEmptyParameters(t *testing.T) {
+	ssa := recoverContract(t, dispatcher + "00")
+	var entries []map[string]interface{}
+	if err := json.Unmarshal([]byte(ssa.ABI()), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected one entry, got %v", ssa.ABI())
+	}
+	for _, key := range []string{"inputs", "outputs"} {
+		if list, ok := entries[0][key].([]interface{}); !ok || len(list) != 0 {
+			t.Errorf("expected empty %v, got %v", key, ssa.ABI())
+		}
+	}
+	if !strings.Contains(ssa.ABI(), `"name": "transfer"`) {
+		t.Errorf("expected transfer, got %v", ssa.ABI())
+	}
+}
+
+func TestABIEntryShapes(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected map[string]string
+		missing  []string
+	}{
+		{
+			// s[0] = 1
+			"fallback",
+			"600160005500",
+			map[string]string{"type": "fallback", "stateMutability": "payable"},
+			[]string{"inputs", "outputs", "name"},
+		},
+		{
+			// ERC-20 Transfer(msg.sender, msg.data[4], 1)
+			"event",
+			dispatcher + "6001600052" + "600435" + "33" + pushTopic("Transfer(address,address,uint256)") +
+				"60206000a3" + "00",
+			map[string]string{"type": "event", "name": "Transfer", "anonymous": "false",
+				"inputs": `[{"indexed":true,"name":"","type":"address"},{"indexed":true,"name":"","type":"address"},` +
+					`{"indexed":false,"name":"","type":"uint256"}]`},
+			[]string{"outputs", "stateMutability"},
+		},
+	}
+	for _, test := range tests {
+		abi := recoverContract(t, test.code).ABI()
+		var entries []map[string]interface{}
+		if err := json.Unmarshal([]byte(abi), &entries); err != nil {
+			t.Fatal(err)
+		}
+		var entry map[string]interface{}
+		for _, other := range entries {
+			if other["type"] == test.expected["type"] {
+				entry = other
+			}
+		}
+		if entry == nil {
+			t.Errorf("%v: expected an entry, got %v", test.name, abi)
+			continue
+		}
+		for key, expected := range test.expected {
+			value, _ := json.Marshal(entry[key])
+			if str, ok := entry[key].(string); ok {
+				value = []byte(str)
+			}
+			if string(value) != expected {
+				t.Errorf("%v: expected %v %v, got %v", test.name, key, expected, string(value))
+			}
+		}
+		for _, key := range test.missing {
+			if _, ok := entry[key]; ok {
+				t.Errorf("%v: unexpected %v in %v", test.name, key, abi)
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package evmdis
+
+import (
+	"math/big"
+)
+
+var (
+	wordModulus = new(big.Int).Lsh(big.NewInt(1), 256)
+	wordMask    = new(big.Int).Sub(wordModulus, big.NewInt(1))
+	signBit     = new(big.Int).Lsh(big.NewInt(1), 255)
+)
+
+// Reduces a value to an unsigned 256 bit word
+func toWord(value *big.Int) *big.Int {
+	return value.And(value, wordMask)
+}
+
+// Interprets a word as a two's complement signed number
+func toSigned(value *big.Int) *big.Int {
+	if value.Cmp(signBit) >= 0 {
+		return new(big.Int).Sub(value, wordModulus)
+	}
+	return value
+}
+
+// A mask of the lowest n bits
+func lowMask(n uint) *big.Int {
+	mask := new(big.Int).Lsh(big.NewInt(1), n)
+	return mask.Sub(mask, big.NewInt(1))
+}
+
+func boolWord(value bool) *big.Int {
+	if value {
+		return big.NewInt(1)
+	}
+	return big.NewInt(0)
+}
+
+// Computes the result of an instruction on constant arguments with EVM
+// semantics. Arguments are in stack order, the top of the stack first.
+// Returns false if the instruction has no constant result.
+func Evaluate(op OpCode, args ...*big.Int) (*big.Int, bool) {
+	if len(args) != op.StackReads() || op.StackWrites() != 1 {
+		return nil, false
+	}
+	result := new(big.Int)
+	switch op {
+	case ADD:
+		result.Add(args[0], args[1])
+	case MUL:
+		result.Mul(args[0], args[1])
+	case SUB:
+		result.Sub(args[0], args[1])
+	case DIV:
+		if args[1].Sign() != 0 {
+			result.Div(args[0], args[1])
+		}
+	case SDIV:
+		if args[1].Sign() != 0 {
+			result.Quo(toSigned(args[0]), toSigned(args[1]))
+		}
+	case MOD:
+		if args[1].Sign() != 0 {
+			result.Mod(args[0], args[1])
+		}
+	case SMOD:
+		if args[1].Sign() != 0 {
+			result.Rem(toSigned(args[0]), toSigned(args[1]))
+		}
+	case ADDMOD:
+		if args[2].Sign() != 0 {
+			result.Add(args[0], args[1])
+			result.Mod(result, args[2])
+		}
+	case MULMOD:
+		if args[2].Sign() != 0 {
+			result.Mul(args[0], args[1])
+			result.Mod(result, args[2])
+		}
+	case EXP:
+		result.Exp(args[0], args[1], wordModulus)
+	case SIGNEXTEND:
+		result.Set(args[1])
+		if args[0].IsInt64() && args[0].Int64() < 31 {
+			bits := uint(args[0].Int64() + 1) * 8
+			if args[1].Bit(int(bits) - 1) == 1 {
+				result.Or(result, new(big.Int).Xor(wordMask, lowMask(bits)))
+			} else {
+				result.And(result, lowMask(bits))
+			}
+		}
+	case LT:
+		result = boolWord(args[0].Cmp(args[1]) < 0)
+	case GT:
+		result = boolWord(args[0].Cmp(args[1]) > 0)
+	case SLT:
+		result = boolWord(toSigned(args[0]).Cmp(toSigned(args[1])) < 0)
+	case SGT:
+		result = boolWord(toSigned(args[0]).Cmp(toSigned(args[1])) > 0)
+	case EQ:
+		result = boolWord(args[0].Cmp(args[1]) == 0)
+	case ISZERO:
+		result = boolWord(args[0].Sign() == 0)
+	case AND:
+		result.And(args[0], args[1])
+	case OR:
+		result.Or(args[0], args[1])
+	case XOR:
+		result.Xor(args[0], args[1])
+	case NOT:
+		result.Xor(args[0], wordMask)
+	case BYTE:
+		if args[0].IsInt64() && args[0].Int64() < 32 {
+			shift := uint(31 - args[0].Int64()) * 8
+			result.Rsh(args[1], shift)
+			result.And(result, big.NewInt(0xff))
+		}
+	case SHL:
+		if args[0].IsInt64() && args[0].Int64() < 256 {
+			result.Lsh(args[1], uint(args[0].Int64()))
+		}
+	case SHR:
+		if args[0].IsInt64() && args[0].Int64() < 256 {
+			result.Rsh(args[1], uint(args[0].Int64()))
+		}
+	case SAR:
+		shift := uint(255)
+		if args[0].IsInt64() && args[0].Int64() < 256 {
+			shift = uint(args[0].Int64())
+		}
+		result.Rsh(toSigned(args[1]), shift)
+	default:
+		return nil, false
+	}
+	return toWord(result), true
+}
@@ -0,0 +1,557 @@
+package evmdis
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// A contract called through functions it is known or recovered to have
+type Interface struct {
+	Name            string
+	Functions       []*ExternalFunction
+}
+
+func (iface *Interface) function(selector uint32) *ExternalFunction {
+	for _, function := range iface.Functions {
+		if function.Selector == selector {
+			return function
+		}
+	}
+	return nil
+}
+
+func (iface *Interface) Declaration() string {
+	str := fmt.Sprintf("interface %v {\n", iface.Name)
+	for _, function := range iface.Functions {
+		if function.Guessed {
+			str += fmt.Sprintf("\t// Guessed signature of 0x%08x\n", function.Selector)
+		}
+		str += fmt.Sprintf("\t%v\n", function.Declaration())
+	}
+	return str + "}\n"
+}
+
+// A function of another contract that is called
+type ExternalFunction struct {
+	Selector        uint32
+	Signature       string   // Empty if the selector was not resolved
+	Guessed         bool     // Made up from common names and argument lists
+	Types           []string
+	ReturnTypes     []string
+	Mutability      string   // Empty for functions that may change state
+}
+
+func (function *ExternalFunction) Name() string {
+	if function.Signature == "" {
+		return fmt.Sprintf("func_%08x", function.Selector)
+	}
+	name, _ := splitSignature(function.Signature)
+	return name
+}
+
+func (function *ExternalFunction) Declaration() string {
+	types := make([]string, len(function.Types))
+	for i, parameterType := range function.Types {
+		types[i] = parameterType + dataLocation(parameterType, "calldata")
+	}
+	str := fmt.Sprintf("function %v(%v) external", function.Name(), strings.Join(types, ", "))
+	if function.Mutability != "" {
+		str += " " + function.Mutability
+	}
+	if len(function.ReturnTypes) > 0 {
+		types = make([]string, len(function.ReturnTypes))
+		for i, returnType := range function.ReturnTypes {
+			types[i] = returnType + dataLocation(returnType, "memory")
+		}
+		str += fmt.Sprintf(" returns (%v)", strings.Join(types, ", "))
+	}
+	return str + ";"
+}
+
+// Interfaces the functions called on a contract are looked up in before
+// one is made up for them, with the types the functions return
+var knownInterfaces = []struct {
+	Name            string
+	Functions       map[string][]string
+}{
+	{"IERC20", map[string][]string{
+		"totalSupply()":                         {"uint256"},
+		"balanceOf(address)":                    {"uint256"},
+		"transfer(address,uint256)":             {"bool"},
+		"transferFrom(address,address,uint256)": {"bool"},
+		"approve(address,uint256)":              {"bool"},
+		"allowance(address,address)":            {"uint256"},
+		"name()":                                {"string"},
+		"symbol()":                              {"string"},
+		"decimals()":                            {"uint8"},
+	}},
+	{"IERC721", map[string][]string{
+		"balanceOf(address)":                              {"uint256"},
+		"ownerOf(uint256)":                                {"address"},
+		"safeTransferFrom(address,address,uint256)":       nil,
+		"safeTransferFrom(address,address,uint256,bytes)": nil,
+		"transferFrom(address,address,uint256)":           nil,
+		"approve(address,uint256)":                        nil,
+		"getApproved(uint256)":                            {"address"},
+		"setApprovalForAll(address,bool)":                 nil,
+		"isApprovedForAll(address,address)":               {"bool"},
+	}},
+	{"IWETH", map[string][]string{
+		"deposit()":                 nil,
+		"withdraw(uint256)":         nil,
+		"balanceOf(address)":        {"uint256"},
+		"transfer(address,uint256)": {"bool"},
+	}},
+}
+
+// A call of another contract recovered from a call statement. The
+// statement keeps the gas, the address called, the value sent with CALL
+// and the arguments as its inputs after the call. The gas is nil if the
+// call forwards all gas or the stipend.
+type ExternalCall struct {
+	Expression
+	Op              OpCode
+	Interface       *Interface        // Nil for value transfers
+	Function        *ExternalFunction // Nil for value transfers
+	Checked         bool              // Reverts if the call fails
+	Stipend         bool              // Forwards only the gas stipend of a transfer
+	AllGas          bool              // Forwards all gas left
+}
+
+// Returns true if the call is written in a form that reverts when it
+// fails, its success flag is always true
+func (call *ExternalCall) reverts() bool {
+	if !call.Checked {
+		return false
+	}
+	if call.Function == nil {
+		return call.Stipend
+	}
+	return call.Op == CALL || call.Op == STATICCALL
+}
+
+// The name a value the call returned is bound to
+func returnName(success *Variable, index int) string {
+	return fmt.Sprintf("%v_%v", success, index)
+}
+
+// Declares what the call statement returns. Calls through an interface
+// bind the values returned after the success flag, low level calls
+// return the flag and the data.
+func (call *ExternalCall) declaration(success *Variable) string {
+	switch {
+	case call.reverts() && call.Function != nil && len(call.Function.ReturnTypes) > 0:
+		results := make([]string, len(call.Function.ReturnTypes))
+		for i, returnType := range call.Function.ReturnTypes {
+			results[i] = fmt.Sprintf("%v%v %v", returnType, dataLocation(returnType, "memory"), returnName(success, i))
+		}
+		return fmt.Sprintf("(%v) = ", strings.Join(results, ", "))
+	case call.reverts():
+		return ""
+	case call.Function == nil && call.Stipend:
+		return fmt.Sprintf("bool %v = ", success)
+	}
+	return fmt.Sprintf("(bool %v, ) = ", success)
+}
+
+// The call a call statement is recovered as, followed by the inputs
+func externalCall(op OpCode, inputs []Expression) (*ExternalCall, bool) {
+	if bufferInput(op) < 1 || len(inputs) == 0 {
+		return nil, false
+	}
+	call, ok := inputs[0].(*ExternalCall)
+	return call, ok
+}
+
+// Checked calls of functions are written as calls through the interface,
+// other calls as the low level calls they are
+func renderCall(call *ExternalCall, inputs []Expression) string {
+	gas, target, arguments := inputs[0], inputs[1], inputs[2:]
+	var value Expression
+	if call.Op == CALL || call.Op == CALLCODE {
+		value, arguments = arguments[0], arguments[1:]
+	}
+	options := make([]string, 0)
+	if value != nil && !isConstant(value, 0) {
+		options = append(options, fmt.Sprintf("value: %v", value))
+	}
+	if !call.AllGas && !call.Stipend {
+		options = append(options, fmt.Sprintf("gas: %v", gas))
+	}
+	braces := ""
+	if len(options) > 0 {
+		braces = fmt.Sprintf("{%v}", strings.Join(options, ", "))
+	}
+	
+	if call.Function == nil {
+		switch {
+		case call.reverts():
+			return fmt.Sprintf("payable(%v).transfer(%v)", addressOperand(target), value)
+		case call.Stipend:
+			return fmt.Sprintf("payable(%v).send(%v)", addressOperand(target), value)
+		}
+		return fmt.Sprintf("payable(%v).call%v(\"\")", addressOperand(target), braces)
+	}
+	str := ""
+	for i, argument := range arguments {
+		if i > 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("%v", argument)
+	}
+	if call.reverts() {
+		return fmt.Sprintf("%v(%v).%v%v(%v)", call.Interface.Name, target, call.Function.Name(), braces, str)
+	}
+	selector := fmt.Sprintf("%v.%v.selector", call.Interface.Name, call.Function.Name())
+	if len(arguments) > 0 {
+		selector += ", "
+	}
+	return fmt.Sprintf("%v.%v%v(abi.encodeWithSelector(%v%v))", addressOperand(target),
+		opCodeInfo[call.Op].Solidity, braces, selector, str)
+}
+
+// A word of the data a call through an interface returned, read from
+// where the call wrote it
+type ReturnValue struct {
+	Expression
+	Index           int
+	Name            string // Bound by the declaration of the call
+	Type            string
+}
+
+// The value a load is recovered as
+func returnedValue(op OpCode, inputs []Expression) (*ReturnValue, bool) {
+	if op != MLOAD || len(inputs) != 1 {
+		return nil, false
+	}
+	value, ok := inputs[0].(*ReturnValue)
+	return value, ok
+}
+
+type callAnalysis struct {
+	*returnDecoder
+	ssa             *SSAProgram
+	interfaces      map[string]*Interface
+}
+
+// The contract called, the same for all calls of an address read from the
+// same state variable
+func (c *callAnalysis) targetKey(target Expression) string {
+	if cast, ok := target.(*Cast); ok {
+		target = cast.Value
+	}
+	if statement := c.definition(target); statement != nil {
+		if location, ok := storageOperand(statement.Op, statement.Inputs); ok {
+			return location.String()
+		}
+	}
+	return expressionKey(target)
+}
+
+// Returns true if the code from the statement at the index reverts
+// without branching
+func (c *callAnalysis) reverts(block *StatementBlock, index int) bool {
+	for depth := 0; block != nil && depth < 4; depth++ {
+		if block == c.ssa.ErrorBlock {
+			return true
+		}
+		next := block.NextBlock
+		for _, statement := range block.Statements[index:] {
+			switch {
+			case statement.Op == REVERT, statement.Op == INVALID:
+				return true
+			case statement.Op == JUMP && len(block.JumpTargets) == 1:
+				next = block.JumpTargets[0]
+			case statement.Op.IsControlFlow():
+				return false
+			}
+		}
+		block, index = next, 0
+	}
+	return false
+}
+
+// The conditional jump that leads to code that reverts when the success
+// flag is zero, followed by its index in the block and among the
+// conditional jumps of the block
+func (c *callAnalysis) failure(success *Variable) (*StatementBlock, int, int, bool) {
+	for _, block := range c.ssa.Blocks {
+		jump := 0
+		for i, statement := range block.Statements {
+			if statement.Op != JUMPI {
+				continue
+			}
+			condition := statement.Inputs[1]
+			switch definition := c.definition(condition); {
+			case expressionKey(condition) == success.Label:
+				if c.reverts(block, i + 1) {
+					return block, i, jump, true
+				}
+			case definition != nil && definition.Op == ISZERO && expressionKey(definition.Inputs[0]) == success.Label:
+				if jump < len(block.CondBlocks) && c.reverts(block.CondBlocks[jump], 0) {
+					return block, i, jump, true
+				}
+			}
+			jump++
+		}
+	}
+	return nil, 0, 0, false
+}
+
+// Returns true if the code reverts when the success flag is zero
+func (c *callAnalysis) checked(success *Variable) bool {
+	_, _, _, ok := c.failure(success)
+	return ok
+}
+
+// Removes the path to the code that reverts when the call fails, the call
+// is written in a form that reverts itself
+func (c *callAnalysis) removeFailure(success *Variable) {
+	block, i, jump, ok := c.failure(success)
+	if !ok || jump >= len(block.CondBlocks) || jump >= len(block.CondOutputs) || len(block.Statements[i].Targets) > 0 {
+		return
+	}
+	statement := block.Statements[i]
+	if expressionKey(statement.Inputs[1]) == success.Label {
+		// The jump past the code that reverts is always taken
+		if block.CondBlocks[jump] == nil {
+			return
+		}
+		statement.Op = JUMP
+		statement.Inputs = statement.Inputs[:1]
+		block.Statements = block.Statements[:i + 1]
+		block.NextBlock = block.CondBlocks[jump]
+		block.Outputs = block.CondOutputs[jump]
+	} else {
+		// The jump to the code that reverts is never taken
+		block.Statements = append(block.Statements[:i], block.Statements[i + 1:]...)
+	}
+	block.CondBlocks = append(block.CondBlocks[:jump], block.CondBlocks[jump + 1:]...)
+	block.CondOutputs = append(block.CondOutputs[:jump], block.CondOutputs[jump + 1:]...)
+	c.ssa.UpdateEdges(block)
+}
+
+// The interface of the contract called, one for every contract
+func (c *callAnalysis) iface(target Expression) *Interface {
+	key := c.targetKey(target)
+	iface := c.interfaces[key]
+	if iface == nil {
+		iface = &Interface{Functions: make([]*ExternalFunction, 0)}
+		c.interfaces[key] = iface
+	}
+	return iface
+}
+
+// Names the interfaces after the known interface that has all of their
+// functions, merging interfaces with the same name. Other interfaces are
+// numbered.
+func (c *callAnalysis) nameInterfaces(calls []*ExternalCall) {
+	named := make(map[string]*Interface)
+	merged := make(map[*Interface]*Interface)
+	for _, call := range calls {
+		iface := call.Interface
+		if _, ok := merged[iface]; ok {
+			continue
+		}
+		name := ""
+		for _, known := range knownInterfaces {
+			all := true
+			for _, function := range iface.Functions {
+				_, ok := known.Functions[function.Signature]
+				all = all && ok
+			}
+			if all {
+				name = known.Name
+				for _, function := range iface.Functions {
+					function.ReturnTypes = known.Functions[function.Signature]
+				}
+				break
+			}
+		}
+		if name == "" {
+			name = fmt.Sprintf("Interface%v", len(c.ssa.Interfaces) + 1)
+		}
+		if other, ok := named[name]; ok {
+			for _, function := range iface.Functions {
+				if other.function(function.Selector) == nil {
+					other.Functions = append(other.Functions, function)
+				}
+			}
+			merged[iface] = other
+			continue
+		}
+		iface.Name = name
+		named[name] = iface
+		merged[iface] = iface
+		c.ssa.Interfaces = append(c.ssa.Interfaces, iface)
+	}
+	for _, call := range calls {
+		call.Interface = merged[call.Interface]
+	}
+}
+
+// The values a call returned, read from memory where it wrote them in the
+// code the call dominates before anything else is stored there
+func (c *callAnalysis) returned(block *StatementBlock, index int, offset Expression, size Expression) map[*Statement]int {
+	loads := make(map[*Statement]int)
+	start, ok := c.address(offset)
+	length, constant := c.length(size)
+	if !ok || !constant || length <= 0 {
+		return loads
+	}
+	for _, other := range c.ssa.Blocks {
+		if !c.dominators.Dominates(block, other) {
+			continue
+		}
+		for i, statement := range other.Statements {
+			if statement.Op != MLOAD || other == block && i <= index {
+				continue
+			}
+			address, ok := c.address(statement.Inputs[0])
+			word := address.Offset - start.Offset
+			if !ok || address.Base != start.Base || word < 0 || word >= length || word % 32 != 0 {
+				continue
+			}
+			
+			// Stores after the call overwrite what it returned
+			if stored, ok := c.words(other, i, start)[word]; ok {
+				storeBlock, j := c.position(stored.Store)
+				if storeBlock == block && j > index || storeBlock != block && c.dominators.Dominates(block, storeBlock) {
+					continue
+				}
+			}
+			loads[statement] = int(word / 32)
+		}
+	}
+	return loads
+}
+
+// Recovers the calls of other contracts from call statements whose
+// arguments were recovered by RecoverMemory: the function called with its
+// selector, value transfers, whether the call reverts on failure and the
+// values decoded from the data returned. The functions called on the same
+// contract make up an interface. Must run after RecoverMemory.
+func (ssa *SSAProgram) RecoverCalls() {
+	if ssa.Signatures == nil {
+		ssa.Signatures = NewSignatureDatabase()
+	}
+	c := &callAnalysis{
+		returnDecoder: &returnDecoder{
+			memoryAnalysis: ssa.memoryAnalysis(),
+			types:          ssa.typeInference(),
+		},
+		ssa:        ssa,
+		interfaces: make(map[string]*Interface),
+	}
+	ssa.Interfaces = make([]*Interface, 0)
+	calls := make(map[*Statement][]Expression)
+	recovered := make([]*ExternalCall, 0)
+	loads := make(map[*Statement][]Expression)
+	successes := make([]*Variable, 0)
+	for _, block := range ssa.Blocks {
+		for i, statement := range block.Statements {
+			// Solidity has no call with the code of another contract
+			input := bufferInput(statement.Op)
+			if input < 1 || len(statement.Inputs) != input + 3 || statement.Op == CALLCODE {
+				continue
+			}
+			encoding, ok := statement.Inputs[input].(*Encoding)
+			if !ok || statement.Output == nil {
+				continue
+			}
+			call := &ExternalCall{
+				Op:      statement.Op,
+				Checked: c.checked(statement.Output),
+			}
+			if gas := c.definition(statement.Inputs[0]); gas != nil {
+				call.AllGas = gas.Op == GAS
+				call.Stipend = gas.Op == MUL && (isConstant(gas.Inputs[0], 2300) || isConstant(gas.Inputs[1], 2300))
+			}
+			inputs := append([]Expression{call}, statement.Inputs[:input]...)
+			if call.AllGas || call.Stipend {
+				inputs[1] = nil
+			}
+			
+			switch {
+			case encoding.Selector == nil && len(encoding.Values) == 0 && statement.Op == CALL:
+			case encoding.Selector != nil:
+				selector := uint32(encoding.Selector.(Constant).Value.Uint64())
+				signature, guessed, resolved := ssa.Signatures.Resolve(selector)
+				_, types := splitSignature(signature)
+				if !resolved || len(types) != len(encoding.Values) {
+					signature = ""
+					guessed = false
+				}
+				call.Interface = c.iface(statement.Inputs[1])
+				recovered = append(recovered, call)
+				call.Function = call.Interface.function(selector)
+				if call.Function == nil {
+					call.Function = &ExternalFunction{Selector: selector, Signature: signature, Guessed: guessed}
+					if signature != "" {
+						call.Function.Types = types
+					} else {
+						for _, value := range encoding.Values {
+							call.Function.Types = append(call.Function.Types, c.parameterType(value))
+						}
+					}
+					call.Interface.Functions = append(call.Interface.Functions, call.Function)
+				}
+				switch {
+				case statement.Op == STATICCALL:
+					call.Function.Mutability = "view"
+				case statement.Op == CALL && !isConstant(statement.Inputs[2], 0):
+					call.Function.Mutability = "payable"
+				}
+				inputs = append(inputs, encoding.Values...)
+			default:
+				continue
+			}
+			calls[statement] = inputs
+			if !call.reverts() {
+				continue
+			}
+			
+			// The success flag of calls that revert on failure is true.
+			// The types returned are known for known interfaces, else
+			// inferred from the values decoded.
+			successes = append(successes, statement.Output)
+			if call.Function == nil {
+				continue
+			}
+			returned := c.returned(block, i, statement.Inputs[input + 1], statement.Inputs[input + 2])
+			types := make([]string, 0)
+			values := make([]*ReturnValue, 0, len(returned))
+			for load, index := range returned {
+				value := &ReturnValue{Index: index, Name: returnName(statement.Output, index)}
+				values = append(values, value)
+				loads[load] = []Expression{value}
+				for len(types) <= index {
+					types = append(types, "uint256")
+				}
+				if load.Output != nil {
+					types[index] = c.types.argumentType(load.Output)
+				}
+			}
+			if len(types) > len(call.Function.ReturnTypes) {
+				call.Function.ReturnTypes = types
+			}
+			for _, value := range values {
+				value.Type = call.Function.ReturnTypes[value.Index]
+			}
+		}
+	}
+	c.nameInterfaces(recovered)
+	for statement, inputs := range calls {
+		statement.Inputs = inputs
+	}
+	for statement, inputs := range loads {
+		statement.Inputs = inputs
+	}
+	for _, success := range successes {
+		c.removeFailure(success)
+		for _, block := range ssa.Blocks {
+			block.Replace(*success, &Cast{Type: "bool", Value: Constant{Value: big.NewInt(1)}})
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package evmdis
+
+import (
+	"strings"
+	"testing"
+)
+
+// Hashes msg.data[4] and msg.data[0x24] into slot 0 and encodes
+// transfer(msg.data[4], msg.data[0x24]) to call msg.data[4] with all gas
+const callPrefix = "608060405260003560e01c8063123456781461001a57600080fd5b600435602435" +
+	"6040518281528181602001526040902060005560405163a9059cbb60e01b81528281600401528181602401" +
+	"528060440180604052602082838303846000885a"
+
+func TestRecoverCalls(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		expected   []string
+		unexpected []string
+	}{
+		{
+			// Both calls jump to a revert when they fail, the returned
+			// bool is stored in slot 1 and the value sent to the caller
+			"checked",
+			callPrefix + "f1156100865781511515600155" + "600082600084863381156108fc02f115610086575050505000" +
+				"5b600080fd",
+			[]string{"\t\t(bool x16_0) = IERC20(x4).transfer(x4, x5);\n", "\t\tvar_1 = x16_0;\n",
+				"\t\tpayable(address(msg.sender)).transfer(x5);\n"},
+			[]string{"returndata(", "if ("},
+		},
+		{
+			// The value is sent with a jump past the revert
+			"jump past revert",
+			callPrefix + "f11561008a5781511515600155" + "600082600084863381156108fc02f161008457600080fd5b5050505000" +
+				"5b600080fd",
+			[]string{"\t\t(bool x16_0) = IERC20(x4).transfer(x4, x5);\n",
+				"\t\tpayable(address(msg.sender)).transfer(x5);\n"},
+			[]string{"if (", "revert("},
+		},
+		{
+			"unchecked",
+			callPrefix + "f1505050505000",
+			[]string{"(bool x16, ) = address(x4).call(abi.encodeWithSelector(IERC20.transfer.selector, x4, x5));"},
+			nil,
+		},
+		{
+			// Solidity has no call with the code of another contract
+			"callcode",
+			callPrefix + "f2156100865781511515600155" + "600082600084863381156108fc02f115610086575050505000" +
+				"5b600080fd",
+			[]string{"bool x16 = callcode("},
+			[]string{".callcode("},
+		},
+	}
+	for _, test := range tests {
+		contract := decompile(t, test.code)
+		for _, expected := range test.expected {
+			if !strings.Contains(contract, expected) {
+				t.Errorf("%v: expected %q, got\n%v", test.name, expected, contract)
+			}
+		}
+		for _, unexpected := range test.unexpected {
+			if strings.Contains(contract, unexpected) {
+				t.Errorf("%v: unexpected %q, got\n%v", test.name, unexpected, contract)
+			}
+		}
+	}
+}
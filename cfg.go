@@ -0,0 +1,300 @@
+package evmdis
+
+import (
+	"fmt"
+)
+
+type EdgeKind int
+const (
+	FallthroughEdge EdgeKind = iota // Execution continues with the next block
+	JumpEdge                        // Unconditional jump
+	TrueEdge                        // Conditional jump taken
+	FalseEdge                       // Conditional jump not taken
+	CallEdge                        // Jump into an internal function
+	ReturnEdge                      // Jump back from an internal function
+	ExceptionalEdge                 // Jump to an invalid destination
+)
+
+var edgeKindToString = map[EdgeKind]string{
+	FallthroughEdge: "fallthrough",
+	JumpEdge:        "jump",
+	TrueEdge:        "true",
+	FalseEdge:       "false",
+	CallEdge:        "call",
+	ReturnEdge:      "return",
+	ExceptionalEdge: "exceptional",
+}
+
+func (kind EdgeKind) String() string {
+	return edgeKindToString[kind]
+}
+
+// A node in a control flow graph, either a *BasicBlock or a
+// *StatementBlock
+type Node interface {
+}
+
+func nodeLabel(node Node) string {
+	switch node := node.(type) {
+	case *BasicBlock:
+		return node.Label
+	case *StatementBlock:
+		return node.Label
+	case *exitNode:
+		return "exit"
+	}
+	return fmt.Sprintf("%v", node)
+}
+
+type Edge struct {
+	From            Node
+	To              Node
+	Kind            EdgeKind
+}
+
+func (edge *Edge) String() string {
+	return fmt.Sprintf("%v → %v (%v)", nodeLabel(edge.From), nodeLabel(edge.To), edge.Kind)
+}
+
+// A control flow graph with typed edges. Nodes are kept in insertion
+// order, edges in the order they were added.
+type CFG struct {
+	Entry           Node
+	Nodes           []Node
+	successors      map[Node][]*Edge
+	predecessors    map[Node][]*Edge
+}
+
+func NewCFG(entry Node) *CFG {
+	cfg := &CFG{
+		Entry:        entry,
+		Nodes:        make([]Node, 0),
+		successors:   make(map[Node][]*Edge),
+		predecessors: make(map[Node][]*Edge),
+	}
+	if entry != nil {
+		cfg.AddNode(entry)
+	}
+	return cfg
+}
+
+func (cfg *CFG) HasNode(node Node) bool {
+	_, ok := cfg.successors[node]
+	return ok
+}
+
+func (cfg *CFG) AddNode(node Node) {
+	if cfg.HasNode(node) {
+		return
+	}
+	cfg.Nodes = append(cfg.Nodes, node)
+	cfg.successors[node] = make([]*Edge, 0)
+	cfg.predecessors[node] = make([]*Edge, 0)
+}
+
+// Adds an edge, adding the nodes if needed. Adding an edge that already
+// exists returns the existing edge.
+func (cfg *CFG) AddEdge(from Node, to Node, kind EdgeKind) *Edge {
+	cfg.AddNode(from)
+	cfg.AddNode(to)
+	for _, edge := range cfg.successors[from] {
+		if edge.To == to && edge.Kind == kind {
+			return edge
+		}
+	}
+	edge := &Edge{From: from, To: to, Kind: kind}
+	cfg.successors[from] = append(cfg.successors[from], edge)
+	cfg.predecessors[to] = append(cfg.predecessors[to], edge)
+	return edge
+}
+
+func removeEdge(edges []*Edge, edge *Edge) []*Edge {
+	result := make([]*Edge, 0, len(edges))
+	for _, other := range edges {
+		if other != edge {
+			result = append(result, other)
+		}
+	}
+	return result
+}
+
+func (cfg *CFG) RemoveEdge(edge *Edge) {
+	cfg.successors[edge.From] = removeEdge(cfg.successors[edge.From], edge)
+	cfg.predecessors[edge.To] = removeEdge(cfg.predecessors[edge.To], edge)
+}
+
+// Removes all outgoing edges of the node
+func (cfg *CFG) ClearSuccessors(node Node) {
+	for _, edge := range cfg.successors[node] {
+		cfg.predecessors[edge.To] = removeEdge(cfg.predecessors[edge.To], edge)
+	}
+	if cfg.HasNode(node) {
+		cfg.successors[node] = make([]*Edge, 0)
+	}
+}
+
+// Removes the node and all edges from and to it
+func (cfg *CFG) RemoveNode(node Node) {
+	if !cfg.HasNode(node) {
+		return
+	}
+	cfg.ClearSuccessors(node)
+	for _, edge := range cfg.predecessors[node] {
+		cfg.successors[edge.From] = removeEdge(cfg.successors[edge.From], edge)
+	}
+	delete(cfg.successors, node)
+	delete(cfg.predecessors, node)
+	nodes := make([]Node, 0, len(cfg.Nodes))
+	for _, other := range cfg.Nodes {
+		if other != node {
+			nodes = append(nodes, other)
+		}
+	}
+	cfg.Nodes = nodes
+	if cfg.Entry == node {
+		cfg.Entry = nil
+	}
+}
+
+func (cfg *CFG) Successors(node Node) []*Edge {
+	return cfg.successors[node]
+}
+
+func (cfg *CFG) Predecessors(node Node) []*Edge {
+	return cfg.predecessors[node]
+}
+
+// The distinct nodes the node has edges to
+func (cfg *CFG) SuccessorNodes(node Node) []Node {
+	nodes := make([]Node, 0)
+	seen := make(map[Node]bool)
+	for _, edge := range cfg.successors[node] {
+		if !seen[edge.To] {
+			seen[edge.To] = true
+			nodes = append(nodes, edge.To)
+		}
+	}
+	return nodes
+}
+
+// The distinct nodes with edges to the node
+func (cfg *CFG) PredecessorNodes(node Node) []Node {
+	nodes := make([]Node, 0)
+	seen := make(map[Node]bool)
+	for _, edge := range cfg.predecessors[node] {
+		if !seen[edge.From] {
+			seen[edge.From] = true
+			nodes = append(nodes, edge.From)
+		}
+	}
+	return nodes
+}
+
+// Depth first search from the entry. Calls pre when a node is first
+// reached and post when all its successors are done, either may be nil.
+func (cfg *CFG) DFS(pre func(node Node), post func(node Node)) {
+	if cfg.Entry == nil {
+		return
+	}
+	depthFirst(cfg.Entry, cfg.SuccessorNodes, pre, post)
+}
+
+func depthFirst(root Node, successors func(node Node) []Node, pre func(node Node), post func(node Node)) {
+	visited := make(map[Node]bool)
+	var visit func(node Node)
+	visit = func(node Node) {
+		visited[node] = true
+		if pre != nil {
+			pre(node)
+		}
+		for _, successor := range successors(node) {
+			if !visited[successor] {
+				visit(successor)
+			}
+		}
+		if post != nil {
+			post(node)
+		}
+	}
+	visit(root)
+}
+
+// The nodes reachable from the entry, each after all its successors
+// except along back edges
+func (cfg *CFG) PostOrder() []Node {
+	order := make([]Node, 0)
+	cfg.DFS(nil, func(node Node) {
+		order = append(order, node)
+	})
+	return order
+}
+
+// The nodes reachable from the entry, each before all its successors
+// except along back edges
+func (cfg *CFG) ReversePostOrder() []Node {
+	order := cfg.PostOrder()
+	for i, j := 0, len(order) - 1; i < j; i, j = i + 1, j - 1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+func (cfg *CFG) String() string {
+	str := ""
+	for _, node := range cfg.Nodes {
+		for _, edge := range cfg.successors[node] {
+			str += fmt.Sprintf("%v\n", edge)
+		}
+	}
+	return str
+}
+
+// Builds the control flow graph of the basic blocks. Jumps are followed
+// when the target is pushed right before the jump and is a valid jump
+// destination.
+func (program *Program) CFG() *CFG {
+	if len(program.Blocks) == 0 {
+		return NewCFG(nil)
+	}
+	cfg := NewCFG(program.Blocks[0])
+	blocks := make(map[int]*BasicBlock)
+	for _, block := range program.Blocks {
+		blocks[block.Offset] = block
+		cfg.AddNode(block)
+	}
+	
+	for _, block := range program.Blocks {
+		n := len(block.Instructions)
+		if n == 0 {
+			continue
+		}
+		last := block.Instructions[n - 1]
+		next := blocks[last.Offset + last.Op.OperandSize() + 1]
+		
+		// Constant jump target
+		var target *BasicBlock
+		if n > 1 && block.Instructions[n - 2].Op.IsPush() {
+			arg := block.Instructions[n - 2].Arg
+			if arg.IsInt64() && program.JumpDests.IsValid(int(arg.Int64())) {
+				target = blocks[int(arg.Int64())]
+			}
+		}
+		
+		switch {
+		case last.Op == JUMP:
+			if target != nil {
+				cfg.AddEdge(block, target, JumpEdge)
+			}
+		case last.Op == JUMPI:
+			if target != nil {
+				cfg.AddEdge(block, target, TrueEdge)
+			}
+			if next != nil {
+				cfg.AddEdge(block, next, FalseEdge)
+			}
+		case !last.Op.IsControlFlow() && next != nil:
+			cfg.AddEdge(block, next, FallthroughEdge)
+		}
+	}
+	return cfg
+}
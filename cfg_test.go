@@ -0,0 +1,41 @@
+package evmdis
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func compileSSA(t *testing.T, code string) *SSAProgram {
+	bytecode, err := hex.DecodeString(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssa := CompileSSA(NewProgram(bytecode, LatestFork))
+	ssa.ComputeJumpTargets()
+	ssa.ComputeIncoming()
+	return ssa
+}
+
+func TestCollapseKeepsConditionalTarget(t *testing.T) {
+	// JUMPI(0x5, 0x1) both jumps and falls through to the JUMPDEST
+	ssa := compileSSA(t, "60016005575b00")
+	var target *StatementBlock
+	for _, block := range ssa.Blocks {
+		if block.Offset == 5 {
+			target = block
+		}
+	}
+	if target == nil {
+		t.Fatalf("no block at the JUMPDEST")
+	}
+	if n := len(ssa.CFG.Predecessors(target)); n != 2 {
+		t.Fatalf("expected 2 edges into the JUMPDEST, got %v", n)
+	}
+	ssa.CollapseJumps()
+	for _, block := range ssa.Blocks {
+		if block == target {
+			return
+		}
+	}
+	t.Errorf("the target of a conditional jump was merged into its source")
+}
@@ -2,34 +2,79 @@ package evmdis
 
 import (
 	"fmt"
+	"strings"
 )
 
+// Names the public functions found by the dispatcher after their
+// signatures and strips the boilerplate of their entry
 func (ssa *SSAProgram) LabelFunctions() {
-	
-	// The 'entry' block looks like this:
-	//
-	// [… 3 instructions …]
-	//  xn = EQ(0x29E99F07, x2)
-    //  JUMPI xn block_m
-	// [… above pattern repeated for every public function …]
-	// [… 2 instructions …]
-	
-	// TODO: Brute force the ABI hash
-	
-	entry := ssa.Blocks[1]
-	for i := 3; i < len(entry.Statements) - 2; i += 2 {
-		hash   := entry.Statements[i + 0].Inputs[0].(Constant).Value
-		offset := entry.Statements[i + 1].Inputs[0].(Constant).Value
-		
-		for _, block := range ssa.Blocks {
-			if block.Offset == int(offset.Int64()) {
-				block.Label = fmt.Sprintf("func_%x", hash)
-				ssa.Unboilerplate(block)
-			}
+	if ssa.Signatures == nil {
+		ssa.Signatures = NewSignatureDatabase()
+	}
+	ssa.PublicFunctions = ssa.FindDispatcher().Functions
+	for _, function := range ssa.PublicFunctions {
+		if function.Kind == PublicFunctionKind {
+			function.Signature, function.Guessed, _ = ssa.Signatures.Resolve(function.Selector)
+		}
+		if function.Skip > 0 {
+			continue
+		}
+		function.Entry.Label = function.Name()
+		if function.Kind == PublicFunctionKind {
+			ssa.Unboilerplate(function.Entry)
 		}
 	}
 }
 
+// A public function, entered through the dispatcher when the call data
+// starts with its selector
+type PublicFunction struct {
+	Kind            FunctionKind
+	Selector        uint32
+	Signature       string // Empty if the selector was not resolved
+	Guessed         bool   // The signature is not known, only hashes to the selector
+	Entry           *StatementBlock
+	Skip            int    // Conditional jumps of the dispatcher in the entry block
+	Payable         bool
+	Types           []string // Inferred from how the arguments are used
+	ReturnTypes     []string // Decoded from the returned data
+}
+
+func (function *PublicFunction) Name() string {
+	switch function.Kind {
+	case FallbackFunctionKind:
+		return "fallback"
+	case ReceiveFunctionKind:
+		return "receive"
+	}
+	if function.Signature == "" {
+		return fmt.Sprintf("func_%08x", function.Selector)
+	}
+	name, _ := splitSignature(function.Signature)
+	return name
+}
+
+// The argument types from the signature, inferred for unresolved
+// functions
+func (function *PublicFunction) argumentTypes() []string {
+	n := len(function.Entry.Inputs)
+	if function.Kind != PublicFunctionKind || function.Skip > 0 {
+		return nil
+	}
+	_, types := splitSignature(function.Signature)
+	if function.Signature != "" && len(types) == n {
+		return types
+	}
+	if len(function.Types) == n {
+		return function.Types
+	}
+	types = make([]string, n)
+	for i := range types {
+		types[i] = "uint256"
+	}
+	return types
+}
+
 func (ssa *SSAProgram) Unboilerplate(block *StatementBlock) {
 	
 	// A function has boilerplate:
@@ -41,88 +86,171 @@ func (ssa *SSAProgram) Unboilerplate(block *StatementBlock) {
 	// x16 = ADD(0x20, 0x4)
 	// x17 = CALLDATALOAD(x16)  // Repeated for every
 	// x18 = ADD(0x20, x16)     // input argument
-	// [… body …]
-	// x21 = MLOAD(0x40)
-	// MSTORE(x21, x32)
-	// x22 = ADD(0x20, x21)     // Repeated for every
-	// MSTORE(x22, x33)         // return value
-	// x23 = ADD(0x20, x22)
-	// x24 = MLOAD(0x40)
-	// x25 = SUB(x23, x24)
-	// RETURN(x24, x25)
+	// [… body, the return data is decoded by DecodeReturns …]
 	
-	// Turn header into block inputs
-	headerLength := 3
-	for ; block.Statements[headerLength].Op == CALLDATALOAD; headerLength += 2 {
-		arg := block.Statements[headerLength].Output
-		block.Inputs = append(block.Inputs, arg)
+	// Turn header into block inputs. Payable functions do not check the
+	// call value.
+	headerLength := 0
+	if headerLength < len(block.Statements) && block.Statements[headerLength].Op == JUMPDEST {
+		headerLength++
+	}
+	if headerLength + 1 < len(block.Statements) &&
+		block.Statements[headerLength].Op == CALLVALUE &&
+		block.Statements[headerLength + 1].Op == JUMPI &&
+		block.Statements[headerLength].Output != nil &&
+		expressionKey(block.Statements[headerLength + 1].Inputs[1]) == block.Statements[headerLength].Output.Label {
+		headerLength += 2
 	}
-	block.Statements = block.Statements[headerLength:]
 	
-	// Turn trailer into block outputs
-	n := len(block.Statements)
-	trailerLength := 3
-	for ; block.Statements[n - trailerLength - 1].Op == ADD; trailerLength += 2 {
-		arg := block.Statements[n - trailerLength - 2].Inputs[1]
-		block.Outputs = append(block.Outputs, arg)
+	// Only words at constant offsets or after the previous one are
+	// arguments. Dynamic arguments are offsets to their data, which is
+	// decoded in the body.
+	var offset *Variable
+	for headerLength < len(block.Statements) &&
+		block.Statements[headerLength].Op == CALLDATALOAD {
+		load := block.Statements[headerLength]
+		if _, ok := load.Inputs[0].(Constant); !ok &&
+			(offset == nil || expressionKey(load.Inputs[0]) != offset.Label) {
+			break
+		}
+		block.Inputs = append(block.Inputs, load.Output)
+		headerLength++
+		offset = nil
+		if headerLength < len(block.Statements) &&
+			block.Statements[headerLength].Op == ADD &&
+			(isConstant(block.Statements[headerLength].Inputs[0], 0x20) ||
+			isConstant(block.Statements[headerLength].Inputs[1], 0x20)) {
+			offset = block.Statements[headerLength].Output
+			headerLength++
+		}
 	}
-	trailerLength += 1
-    for i, j := 0, len(block.Outputs)-1; i < j; i, j = i+1, j-1 {
-		block.Outputs[i], block.Outputs[j] = block.Outputs[j], block.Outputs[i]
+	for _, statement := range block.Statements[:headerLength] {
+		if statement.Op == JUMPI && len(block.CondBlocks) > 0 && len(block.CondOutputs) > 0 {
+			block.CondBlocks = block.CondBlocks[1:]
+			block.CondOutputs = block.CondOutputs[1:]
+		}
 	}
-	block.Statements = block.Statements[:n - trailerLength]
+	block.Statements = block.Statements[headerLength:]
 }
 
-func (ssa *SSAProgram) Function(block *StatementBlock) string {
+// A block that ends without a control flow statement and has no successor
+// runs off the end of the code, its outputs are the stack it leaves
+func (block *StatementBlock) returnsOutputs() bool {
+	n := len(block.Statements)
+	return block.NextBlock == nil && len(block.JumpTargets) == 0 &&
+		(n == 0 || !block.Statements[n - 1].Op.IsControlFlow())
+}
+
+// The data location dynamic types are declared with
+func dataLocation(parameterType string, location string) string {
+	if parameterType == "bytes" || parameterType == "string" || strings.HasSuffix(parameterType, "]") {
+		return " " + location
+	}
+	return ""
+}
+
+func (ssa *SSAProgram) Function(function *PublicFunction) string {
+	block := function.Entry
 	
 	// Write the function declaration
-	str := fmt.Sprintf("\tfunction %v(", block.Label)
-	for i := 0; i < len(block.Inputs); i++ {
+	str := ""
+	if function.Guessed {
+		str += fmt.Sprintf("\t// Guessed signature of 0x%08x\n", function.Selector)
+	}
+	str += "\t"
+	if function.Kind == PublicFunctionKind {
+		str += "function "
+	}
+	str += fmt.Sprintf("%v(", function.Name())
+	for i, argumentType := range function.argumentTypes() {
 		if i > 0 {
 			str += ", "
 		}
-		str += fmt.Sprintf("uint %v", block.Inputs[i])
+		str += fmt.Sprintf("%v%v %v", argumentType, dataLocation(argumentType, "calldata"), block.Inputs[i])
 	}
-	str += ") "
-	if len(block.Outputs) > 0 {
-		str += "return ("
-		for i := 0; i < len(block.Inputs); i++ {
+	str += ") external "
+	if function.Payable {
+		str += "payable "
+	}
+	
+	if len(function.ReturnTypes) > 0 {
+		str += "returns ("
+		for i, returnType := range function.ReturnTypes {
 			if i > 0 {
 				str += ", "
 			}
-			str += "uint"
+			str += returnType + dataLocation(returnType, "memory")
 		}
 		str += ") "
 	}
 	str += "{\n"
 	
 	// Write the function body
-	for _, statement := range block.Statements {
-		str += fmt.Sprintf("\t\t%v\n", statement)
-	}
+	str += ssa.StructureFrom(block, block.afterJumps(function.Skip), nil)
 	
-	// Write the return statement
-	if len(block.Outputs) > 0 {
-		str += "\t\treturn("
-		for i := 0; i < len(block.Outputs); i++ {
+	str += "\t}\n"
+	return str
+}
+
+func (ssa *SSAProgram) InternalFunction(function *InternalFunction) string {
+	
+	// Write the function declaration, the arguments are the top inputs
+	// of the entry block
+	str := fmt.Sprintf("\tfunction %v(", function.Label)
+	inputs := function.Entry.Inputs
+	for i := 0; i < function.Arguments; i++ {
+		if i > 0 {
+			str += ", "
+		}
+		if j := len(inputs) - function.Arguments + i; j >= 0 {
+			str += fmt.Sprintf("uint %v", inputs[j])
+		} else {
+			str += fmt.Sprintf("uint arg%v", i)
+		}
+	}
+	str += ") private "
+	if function.Results > 0 {
+		str += "returns ("
+		for i := 0; i < function.Results; i++ {
 			if i > 0 {
 				str += ", "
 			}
-			str += fmt.Sprintf("%v", block.Outputs[i])
+			str += "uint"
 		}
-		str += ");\n"
+		str += ") "
 	}
+	str += "{\n"
+	
+	// Write the function body
+	str += ssa.Structure(function.Entry, function)
 	
 	str += "\t}\n"
 	return str
 }
 
 func (ssa *SSAProgram) Contract() string {
-	str := "pragma solidity ^0.4.2;\n\ncontract Decompiled {\n"
-	for _, block := range ssa.Blocks {
-		if block.Label[:5] == "func_" {
-			str += ssa.Function(block)
-		}
+	str := "pragma solidity ^0.8.24;\n\n"
+	for _, iface := range ssa.Interfaces {
+		str += iface.Declaration() + "\n"
+	}
+	str += "contract Decompiled {\n"
+	for _, variable := range ssa.StateVariables {
+		str += fmt.Sprintf("\t%v %v;\n", variable.Declaration(), variable.Name)
+	}
+	if len(ssa.StateVariables) > 0 {
+		str += "\n"
+	}
+	for _, event := range ssa.Events {
+		str += fmt.Sprintf("\t%v\n", event.Declaration())
+	}
+	if len(ssa.Events) > 0 {
+		str += "\n"
+	}
+	for _, function := range ssa.PublicFunctions {
+		str += ssa.Function(function)
+	}
+	for _, function := range ssa.Functions {
+		str += ssa.InternalFunction(function)
 	}
 	str+= "}\n"
 	return str
@@ -0,0 +1,23 @@
+package evmdis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFunctionDeclaration(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"value", "600435600055" + "00", "function transfer(uint256 x5) external {"},
+		{"dynamic", "60043560040135600055" + "00", "function transfer(bytes calldata x5) external {"},
+	}
+	for _, test := range tests {
+		contract := decompile(t, dispatcher + test.body)
+		if !strings.HasPrefix(contract, "pragma solidity ^0.8") || !strings.Contains(contract, test.expected) {
+			t.Errorf("%v: expected %q, got\n%v", test.name, test.expected, contract)
+		}
+	}
+}
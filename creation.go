@@ -0,0 +1,117 @@
+package evmdis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// What kind of bytecode is being disassembled
+type CodeKind int
+const (
+	AutoCode CodeKind = iota // Detect from the code
+	CreationCode             // Constructor followed by the runtime image
+	RuntimeCode              // Deployed contract code
+)
+
+var codeKindToString = map[CodeKind]string{
+	AutoCode:     "auto",
+	CreationCode: "creation",
+	RuntimeCode:  "runtime",
+}
+
+func (kind CodeKind) String() string {
+	return codeKindToString[kind]
+}
+
+func CodeKindByName(name string) (CodeKind, error) {
+	name = strings.ToLower(name)
+	for kind, str := range codeKindToString {
+		if str == name {
+			return kind, nil
+		}
+	}
+	return AutoCode, fmt.Errorf("Unknown code kind: %v", name)
+}
+
+// Disassembles bytecode of the given kind. For creation code both the
+// constructor and the runtime code it deploys are returned, for runtime
+// code the creation program is nil.
+func Disassemble(bytecode []byte, fork Fork, kind CodeKind) (*Program, *Program, error) {
+	switch kind {
+	case RuntimeCode:
+		return nil, NewProgram(bytecode, fork), nil
+	case CreationCode:
+		return SplitCreation(bytecode, fork)
+	}
+	creation, runtime, err := SplitCreation(bytecode, fork)
+	if err != nil {
+		return nil, NewProgram(bytecode, fork), nil
+	}
+	return creation, runtime, nil
+}
+
+// Separates creation code into a constructor program and the runtime
+// program it returns. The runtime program has offsets relative to the
+// start of the runtime image, as it will be deployed.
+func SplitCreation(bytecode []byte, fork Fork) (*Program, *Program, error) {
+	image, err := FindRuntime(bytecode, fork)
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	creation := &Program{
+		Fork: fork,
+		Code: bytecode,
+	}
+	creation.classifyRegions(&image)
+	creation.AnalyseJumpDests()
+	for _, region := range creation.Regions {
+		if region.IsCode() {
+			creation.disassemble(region.Offset, region.End())
+		}
+	}
+	creation.MarkReachable()
+	if len(creation.Blocks) > 0 {
+		creation.Blocks[0].Label = "create"
+	}
+	
+	runtime := NewProgram(bytecode[image.Offset:image.End()], fork)
+	if len(runtime.Blocks) > 0 {
+		runtime.Blocks[0].Label = "enter"
+	}
+	return creation, runtime, nil
+}
+
+// Finds the runtime image in creation code by following the constructor
+// from the entry point until a RETURN of memory that was filled with a
+// CODECOPY.
+func FindRuntime(bytecode []byte, fork Fork) (Region, error) {
+	scan := &Program{
+		Fork:      fork,
+		Code:      bytecode,
+		JumpDests: NewJumpDestAnalysis(bytecode),
+	}
+	scan.disassemble(0, len(bytecode))
+	
+	var image Region
+	found := false
+	scan.explore(func(state *abstractState, instruction *Instruction, args []abstractValue) bool {
+		if instruction.Op != RETURN {
+			return false
+		}
+		copied, ok := state.Copies[args[0].Key()]
+		size := args[1].Value
+		if !ok || copied.Size == 0 || size == nil || !size.IsInt64() ||
+			size.Int64() > int64(copied.Size) {
+			return false
+		}
+		image = copied
+		image.Size = int(size.Int64())
+		found = true
+		return true
+	})
+	if !found {
+		return Region{}, fmt.Errorf("Creation code does not return a runtime image")
+	}
+	return image, nil
+}
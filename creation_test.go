@@ -0,0 +1,26 @@
+package evmdis
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// A constructor that returns its own code as the runtime image, leaving
+// no creation blocks outside of it
+const selfReturning = "600c6000600039600c6000f3"
+
+func TestSplitCreationSelfReturning(t *testing.T) {
+	bytecode, _ := hex.DecodeString(selfReturning)
+	for _, kind := range []CodeKind{CreationCode, AutoCode} {
+		creation, runtime, err := Disassemble(bytecode, LatestFork, kind)
+		if err != nil {
+			t.Fatalf("%v: %v", kind, err)
+		}
+		if creation == nil || len(creation.Blocks) != 0 {
+			t.Errorf("%v: expected an empty creation program, got %v", kind, creation)
+		}
+		if len(runtime.Blocks) == 0 || runtime.Blocks[0].Label != "enter" {
+			t.Errorf("%v: expected the runtime to start at enter", kind)
+		}
+	}
+}
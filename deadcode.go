@@ -0,0 +1,142 @@
+package evmdis
+
+// Returns true if a statement can be removed when its result is unused
+func (statement *Statement) isPure() bool {
+	if statement.Output == nil || statement.Op.writes() != 0 {
+		return false
+	}
+	switch statement.Op {
+	case JUMP, JUMPI, JUMPDEST:
+		return false
+	}
+	return true
+}
+
+// Returns true if the program jumps to computed destinations that were
+// not resolved, any JUMPDEST could then be reached
+func (ssa *SSAProgram) hasUnresolvedJumps() bool {
+	for _, block := range ssa.Blocks {
+		for _, statement := range block.Statements {
+			if statement.Op != JUMP && statement.Op != JUMPI {
+				continue
+			}
+			if _, ok := statement.Inputs[0].(Constant); !ok && len(statement.Targets) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Removes the blocks that cannot be reached from the entry. Returns the
+// number of blocks removed.
+func (ssa *SSAProgram) removeUnreachable() int {
+	if len(ssa.Blocks) == 0 || ssa.hasUnresolvedJumps() {
+		return 0
+	}
+	if ssa.CFG == nil {
+		ssa.ComputeIncoming()
+	}
+	reachable := map[Node]bool{ssa.ErrorBlock: true}
+	ssa.CFG.DFS(func(node Node) {
+		reachable[node] = true
+	}, nil)
+	
+	blocks := make([]*StatementBlock, 0, len(ssa.Blocks))
+	removed := make(map[*StatementBlock]bool)
+	for _, block := range ssa.Blocks {
+		if reachable[block] {
+			blocks = append(blocks, block)
+			continue
+		}
+		removed[block] = true
+		successors := ssa.CFG.SuccessorNodes(block)
+		ssa.CFG.RemoveNode(block)
+		for _, node := range successors {
+			ssa.updateIncoming(node.(*StatementBlock))
+		}
+		delete(ssa.Calls, block)
+	}
+	ssa.Blocks = blocks
+	if len(removed) == 0 {
+		return 0
+	}
+	
+	// Functions that are never called are gone
+	functions := make([]*InternalFunction, 0, len(ssa.Functions))
+	for _, function := range ssa.Functions {
+		if removed[function.Entry] {
+			continue
+		}
+		live := make([]*StatementBlock, 0, len(function.Blocks))
+		for _, block := range function.Blocks {
+			if !removed[block] {
+				live = append(live, block)
+			}
+		}
+		function.Blocks = live
+		functions = append(functions, function)
+	}
+	ssa.Functions = functions
+	return len(removed)
+}
+
+// Removes pure statements and phi nodes whose values are never used,
+// until none are left. Returns the number of statements and phi nodes
+// removed.
+func (ssa *SSAProgram) removeDeadValues() int {
+	count := 0
+	for changed := true; changed; {
+		changed = false
+		uses := ssa.uses()
+		
+		// The caller's stack below the arguments may be read by the
+		// continuation of a call
+		for _, call := range ssa.Calls {
+			for _, output := range call.Block.Outputs {
+				countUses(uses, output)
+			}
+		}
+		
+		for _, block := range ssa.Blocks {
+			statements := make([]*Statement, 0, len(block.Statements))
+			for _, statement := range block.Statements {
+				if statement.isPure() && uses[statement.Output.Label] == 0 {
+					count++
+					changed = true
+					continue
+				}
+				statements = append(statements, statement)
+			}
+			block.Statements = statements
+			
+			// A phi only selecting itself on a back edge is still unused
+			phis := make([]*PhiNode, 0, len(block.Phis))
+			for _, phi := range block.Phis {
+				self := 0
+				for _, input := range phi.Inputs {
+					if expressionKey(input) == phi.Output.Label {
+						self++
+					}
+				}
+				if uses[phi.Output.Label] == self {
+					count++
+					changed = true
+					continue
+				}
+				phis = append(phis, phi)
+			}
+			block.Phis = phis
+		}
+	}
+	return count
+}
+
+// Removes blocks that are unreachable from the entry and statements whose
+// results are never used. Statements with side effects are kept. Returns
+// the number of statements, phi nodes included, and blocks removed.
+func (ssa *SSAProgram) EliminateDeadCode() (int, int) {
+	blocks := ssa.removeUnreachable()
+	statements := ssa.removeDeadValues()
+	return statements, blocks
+}
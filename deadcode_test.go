@@ -0,0 +1,31 @@
+package evmdis
+
+import (
+	"testing"
+)
+
+func TestDeadPhiUsedByItself(t *testing.T) {
+	// entry: x1 = msg.value; loop: a2 = φ(entry: x1, loop: a2)
+	value := &Variable{Label: "x1"}
+	phi := &Variable{Label: "a2"}
+	entry := &StatementBlock{
+		Statements: []*Statement{{Op: CALLVALUE, Inputs: []Expression{}, Output: value}},
+	}
+	loop := &StatementBlock{
+		Statements: []*Statement{{Op: STOP, Inputs: []Expression{}}},
+	}
+	entry.NextBlock = loop
+	loop.Phis = []*PhiNode{{
+		Output: phi,
+		Inputs: []Expression{*value, *phi},
+		Blocks: []*StatementBlock{entry, loop},
+	}}
+	ssa := &SSAProgram{Blocks: []*StatementBlock{entry, loop}}
+	
+	if count := ssa.removeDeadValues(); count != 2 {
+		t.Errorf("expected the phi and the statement it used to be removed, got %v", count)
+	}
+	if len(loop.Phis) != 0 || len(entry.Statements) != 0 {
+		t.Errorf("expected no phi and no statements left, got %v and %v", loop.Phis, entry.Statements)
+	}
+}
@@ -9,6 +9,9 @@ type Instruction struct {
 	Op              OpCode
 	Arg             *big.Int
 	Annotations     *TypeMap
+	Offset          int
+	Undefined       bool // Byte is not an opcode in the fork, Op is INVALID
+	Truncated       bool // Push data runs past the end of the code
 }
 
 func (self *Instruction) String() string {
@@ -19,33 +22,113 @@ func (self *Instruction) String() string {
 	}
 }
 
+type Reachability int
+const (
+	Reachable Reachability = iota // Executed from the entry point
+	Unreachable                   // Valid instructions that never execute
+	DataBlock                     // Unreachable bytes that are not code
+)
+
+var reachabilityToString = map[Reachability]string{
+	Reachable:   "reachable",
+	Unreachable: "unreachable",
+	DataBlock:   "data",
+}
+
+func (reach Reachability) String() string {
+	return reachabilityToString[reach]
+}
+
 type BasicBlock struct {
 	Instructions    []Instruction
 	Label           string
 	Offset          int
 	Reads           int
 	Writes          int
+	Reach           Reachability
+}
+
+type DiagnosticKind int
+const (
+	UndefinedOpcode DiagnosticKind = iota
+	TruncatedPush
+	HiddenJumpDest
+)
+
+type Diagnostic struct {
+	Offset          int
+	Kind            DiagnosticKind
+	Message         string
+}
+
+func (diagnostic Diagnostic) String() string {
+	return fmt.Sprintf("0x%X: %v", diagnostic.Offset, diagnostic.Message)
 }
 
 type Program struct {
 	Blocks          []*BasicBlock
+	Fork            Fork
+	Code            []byte
+	Diagnostics     []Diagnostic
+	Regions         []Region
+	Metadata        *Metadata
+	JumpDests       *JumpDestAnalysis
+}
+
+func (program *Program) Diagnose(offset int, kind DiagnosticKind, format string, args ...interface{}) {
+	program.Diagnostics = append(program.Diagnostics, Diagnostic{
+		Offset:  offset,
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	})
 }
 
-func NewProgram(bytecode []byte) *Program {
-	program := &Program{}
+func NewProgram(bytecode []byte, fork Fork) *Program {
+	program := &Program{
+		Fork: fork,
+		Code: bytecode,
+	}
+	program.classifyRegions(nil)
+	program.AnalyseJumpDests()
+	
+	// Only disassemble the regions that contain instructions
+	for _, region := range program.Regions {
+		if region.IsCode() {
+			program.disassemble(region.Offset, region.End())
+		}
+	}
+	program.MarkReachable()
+	
+	return program
+}
+
+// Linear sweep disassembly of bytecode[start:end] into basic blocks. Push
+// data may run past the end into the following region.
+func (program *Program) disassemble(start int, end int) {
+	bytecode := program.Code
+	fork := program.Fork
 	currentBlock := &BasicBlock{
 		Label: fmt.Sprintf("block_%v", len(program.Blocks)),
-		Offset: 0,
+		Offset: start,
 		Reads: 0,
 	}
 	
 	var currentStackIndex = 0
-	for i := 0; i < len(bytecode); i++ {
+	for i := start; i < end; i++ {
 		
 		// Read next opcode and optional argument
 		op := OpCode(bytecode[i])
+		undefined := !op.IsDefined(fork)
+		if undefined {
+			// Executing an undefined opcode is an exceptional halt, the
+			// same as the designated INVALID instruction.
+			program.Diagnose(i, UndefinedOpcode,
+				"undefined opcode 0x%02X in %v", bytecode[i], fork)
+			op = INVALID
+		}
 		size := op.OperandSize()
 		var arg *big.Int
+		truncated := false
 		if size > 0 {
 			arg = big.NewInt(0)
 			for j := 1; j <= size; j++ {
@@ -54,6 +137,14 @@ func NewProgram(bytecode []byte) *Program {
 					arg.Or(arg, big.NewInt(int64(bytecode[i + j])))
 				}
 			}
+			
+			// The EVM pads missing push data with zeros
+			if i + size >= len(bytecode) {
+				truncated = true
+				program.Diagnose(i, TruncatedPush,
+					"%v has only %v of %v data bytes", op,
+					len(bytecode) - i - 1, size)
+			}
 		}
 		
 		// Start a new basic block on reaching a JUMPDEST
@@ -74,6 +165,9 @@ func NewProgram(bytecode []byte) *Program {
 		instruction := Instruction{
 			Op: op,
 			Arg: arg,
+			Offset: i,
+			Undefined: undefined,
+			Truncated: truncated,
 		}
 		currentBlock.Instructions = append(currentBlock.Instructions, instruction)
 		
@@ -106,22 +200,69 @@ func NewProgram(bytecode []byte) *Program {
 	if len(currentBlock.Instructions) > 0 {
 		program.Blocks = append(program.Blocks, currentBlock)
 	}
-	
-	return program
+}
+
+// Finds the valid jump destinations. Hidden JUMPDEST bytes are only
+// reported in code regions, as data has no instructions to hide them.
+func (program *Program) AnalyseJumpDests() {
+	program.JumpDests = NewJumpDestAnalysis(program.Code)
+	for _, offset := range program.JumpDests.Hidden {
+		if region := program.RegionAt(offset); region == nil || !region.IsCode() {
+			continue
+		}
+		program.Diagnose(offset, HiddenJumpDest,
+			"JUMPDEST byte inside push data is not a valid jump destination")
+	}
 }
 
 func (program *Program) PrintAssembler() {
+	for _, region := range program.Regions {
+		fmt.Printf("# %v\n", region)
+		switch {
+		case region.IsCode():
+			program.printBlocks(region)
+		case region.Kind != RuntimeRegion:
+			program.printData(region)
+		}
+	}
+}
+
+func (program *Program) printData(region Region) {
+	for offset := region.Offset; offset < region.End(); offset += 32 {
+		end := offset + 32
+		if end > region.End() {
+			end = region.End()
+		}
+		fmt.Printf("0x%X\t%x\n", offset, program.Code[offset:end])
+	}
+	fmt.Printf("\n")
+}
+
+func (program *Program) printBlocks(region Region) {
 	for _, block := range program.Blocks {
+		if !region.Contains(block.Offset) {
+			continue
+		}
 		offset := block.Offset
 		
 		// Label the block
-		fmt.Printf("%v: (reads %v, writes %v)\n", block.Label,
+		fmt.Printf("%v: (reads %v, writes %v", block.Label,
 			block.Reads, block.Writes)
+		if block.Reach != Reachable {
+			fmt.Printf(", %v", block.Reach)
+		}
+		fmt.Printf(")\n")
 		for _, instruction := range block.Instructions {
 			fmt.Printf("0x%X\t%v", offset, instruction.Op)
 			if instruction.Arg != nil {
 				fmt.Printf("\t 0x%X", instruction.Arg)
 			}
+			if instruction.Undefined {
+				fmt.Printf("\t // undefined 0x%02X", program.Code[offset])
+			}
+			if instruction.Truncated {
+				fmt.Printf("\t // truncated")
+			}
 			fmt.Printf("\n")
 			offset += instruction.Op.OperandSize() + 1
 		}
@@ -129,19 +270,8 @@ func (program *Program) PrintAssembler() {
 	}
 }
 
-func (program *Program) ParseCreation() {
-	// The program is contract creation code. The entry point is 0x0 and will
-	// at some point use CODECOPY calls to set up the contract at the right
-	// location.
-	// For now we assume the basic behaviour of `solc`. The setup code is in
-	// one basic block (MSTORE, CODECOPY, RETURN) and the second basic block
-	// is the entry point for the Contract ABI.
-	program.Blocks[0].Label = "create"
-	program.Blocks[1].Label = "enter"
-	
-	// Adjust the offsets the blocks.
-	enterOffset := program.Blocks[1].Offset
-	for i := 1; i < len(program.Blocks); i++ {
-		program.Blocks[i].Offset -= enterOffset
+func (program *Program) PrintDiagnostics() {
+	for _, diagnostic := range program.Diagnostics {
+		fmt.Printf("%v\n", diagnostic)
 	}
 }
@@ -0,0 +1,83 @@
+package evmdis
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func disassemble(t *testing.T, code string, fork Fork) *Program {
+	bytecode, err := hex.DecodeString(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProgram(bytecode, fork)
+}
+
+func instructions(program *Program) []Instruction {
+	instructions := make([]Instruction, 0)
+	for _, block := range program.Blocks {
+		instructions = append(instructions, block.Instructions...)
+	}
+	return instructions
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		fork     Fork
+		expected []string
+	}{
+		{"defined", "5f600100", Shanghai, []string{}},
+		{"unassigned", "600c0c00", LatestFork, []string{"0x2: undefined opcode 0x0C in cancun"}},
+		{"before fork", "5f00", London, []string{"0x0: undefined opcode 0x5F in london"}},
+		{"transient storage", "60005c5d", Shanghai,
+			[]string{"0x2: undefined opcode 0x5C in shanghai", "0x3: undefined opcode 0x5D in shanghai"}},
+		// The EVM reads missing push data as zeros
+		{"truncated", "600161ff", LatestFork, []string{"0x2: PUSH2 has only 1 of 2 data bytes"}},
+		{"truncated without data", "600160", LatestFork, []string{"0x2: PUSH1 has only 0 of 1 data bytes"}},
+		{"complete at end", "6001", LatestFork, []string{}},
+	}
+	for _, test := range tests {
+		program := disassemble(t, test.code, test.fork)
+		diagnostics := make([]string, 0)
+		for _, diagnostic := range program.Diagnostics {
+			diagnostics = append(diagnostics, diagnostic.String())
+		}
+		if strings.Join(diagnostics, "; ") != strings.Join(test.expected, "; ") {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, diagnostics)
+		}
+	}
+}
+
+func TestDisassembleFlags(t *testing.T) {
+	program := disassemble(t, "0c" + "61ff", LatestFork)
+	strs := make([]string, 0)
+	for _, instruction := range instructions(program) {
+		strs = append(strs, fmt.Sprintf("%v %v %v", &instruction, instruction.Undefined, instruction.Truncated))
+	}
+	expected := "INVALID true false; PUSH2 0xff00 false true"
+	if str := strings.Join(strs, "; "); str != expected {
+		t.Errorf("expected %v, got %v", expected, str)
+	}
+}
+
+func TestDisassembleRegionBoundary(t *testing.T) {
+	// A PUSH2 at the end of the code region reads its data from the data
+	// following it
+	program := &Program{Code: []byte{0x60, 0x01, 0x61, 0xaa, 0xbb, 0x00}, Fork: LatestFork}
+	program.disassemble(0, 3)
+	strs := make([]string, 0)
+	for _, instruction := range instructions(program) {
+		strs = append(strs, instruction.String())
+	}
+	expected := "PUSH1 0x1; PUSH2 0xaabb"
+	if str := strings.Join(strs, "; "); str != expected {
+		t.Errorf("expected %v, got %v", expected, str)
+	}
+	if len(program.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %v", program.Diagnostics)
+	}
+}
@@ -0,0 +1,360 @@
+package evmdis
+
+import (
+	"math/big"
+)
+
+type FunctionKind int
+const (
+	PublicFunctionKind FunctionKind = iota // Called with a selector
+	FallbackFunctionKind                   // Called when no selector matches
+	ReceiveFunctionKind                    // Called with empty call data
+)
+
+// The public interface of the contract as dispatched by the entry code
+type Dispatcher struct {
+	Selectors       map[uint32]*StatementBlock // The entry of every public function
+	Functions       []*PublicFunction          // In the order they are dispatched
+	Blocks          map[*StatementBlock]bool   // Blocks that only dispatch
+}
+
+type dispatcherAnalysis struct {
+	ssa             *SSAProgram
+	definitions     map[string]*Statement
+	dispatcher      *Dispatcher
+	visited         map[*StatementBlock]bool
+	entries         map[*StatementBlock]bool
+}
+
+// The operation computing the expression, through the statement defining
+// a variable
+func (d *dispatcherAnalysis) operation(expression Expression) (OpCode, []Expression, bool) {
+	switch expression := expression.(type) {
+	case *Operation:
+		return expression.Op, expression.Inputs, true
+	case Variable:
+		if statement, ok := d.definitions[expression.Label]; ok {
+			return statement.Op, statement.Inputs, true
+		}
+	}
+	return STOP, nil, false
+}
+
+// The value of the expression if it only depends on constants
+func (d *dispatcherAnalysis) constant(expression Expression) (*big.Int, bool) {
+	if constant, ok := expression.(Constant); ok {
+		return constant.Value, true
+	}
+	op, inputs, ok := d.operation(expression)
+	if !ok {
+		return nil, false
+	}
+	values := make([]*big.Int, len(inputs))
+	for i, input := range inputs {
+		if values[i], ok = d.constant(input); !ok {
+			return nil, false
+		}
+	}
+	return Evaluate(op, values...)
+}
+
+func (d *dispatcherAnalysis) isConstant(expression Expression, value int64) bool {
+	constant, ok := d.constant(expression)
+	return ok && constant.Cmp(big.NewInt(value)) == 0
+}
+
+// Returns true if the expression depends on the result of the opcode
+func (d *dispatcherAnalysis) uses(expression Expression, op OpCode) bool {
+	other, inputs, ok := d.operation(expression)
+	if !ok {
+		return false
+	}
+	if other == op {
+		return true
+	}
+	for _, input := range inputs {
+		if d.uses(input, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the expression is the first four bytes of the call
+// data. Solidity divides the first word by 2²²⁴ or shifts it right by
+// 224 bits, and may mask the result. Vyper copies the selector to memory.
+func (d *dispatcherAnalysis) isSelector(expression Expression) bool {
+	op, inputs, ok := d.operation(expression)
+	if !ok {
+		return false
+	}
+	isFirstWord := func(expression Expression) bool {
+		op, inputs, ok := d.operation(expression)
+		return ok && op == CALLDATALOAD && d.isConstant(inputs[0], 0)
+	}
+	switch op {
+	case AND:
+		for i := 0; i < 2; i++ {
+			if d.isConstant(inputs[i], 0xffffffff) && d.isSelector(inputs[1 - i]) {
+				return true
+			}
+		}
+	case DIV:
+		divisor, ok := d.constant(inputs[1])
+		return ok && isFirstWord(inputs[0]) && divisor.Cmp(new(big.Int).Lsh(big.NewInt(1), 224)) == 0
+	case SHR:
+		return d.isConstant(inputs[0], 224) && isFirstWord(inputs[1])
+	case MLOAD:
+		return d.isConstant(inputs[0], 0)
+	}
+	return false
+}
+
+// Recognizes a comparison of the selector with a constant. Returns the
+// constant and whether the condition holds when they are equal.
+func (d *dispatcherAnalysis) selectorComparison(condition Expression) (uint32, bool, bool) {
+	op, inputs, ok := d.operation(condition)
+	if !ok {
+		return 0, false, false
+	}
+	switch op {
+	case ISZERO:
+		selector, equal, ok := d.selectorComparison(inputs[0])
+		return selector, !equal, ok
+	case EQ, XOR, SUB:
+		for i := 0; i < 2; i++ {
+			constant, ok := d.constant(inputs[i])
+			if ok && constant.IsUint64() && constant.Uint64() <= 0xffffffff && d.isSelector(inputs[1 - i]) {
+				return uint32(constant.Uint64()), op == EQ, true
+			}
+		}
+	}
+	return 0, false, false
+}
+
+// Returns true for the range checks of a binary search over the selectors
+func (d *dispatcherAnalysis) isSelectorRange(condition Expression) bool {
+	op, inputs, ok := d.operation(condition)
+	if !ok {
+		return false
+	}
+	switch op {
+	case ISZERO:
+		return d.isSelectorRange(inputs[0])
+	case LT, GT:
+		for i := 0; i < 2; i++ {
+			if _, ok := d.constant(inputs[i]); ok && d.isSelector(inputs[1 - i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Statements the dispatcher may contain besides its jumps
+func (d *dispatcherAnalysis) isDispatch(statement *Statement) bool {
+	switch statement.Op {
+	case JUMPDEST, JUMP, JUMPI, CALLVALUE, CALLDATASIZE, CALLDATALOAD:
+		return true
+	case MSTORE:
+		// Initializing the free memory pointer
+		return d.isConstant(statement.Inputs[0], 0x40)
+	case CALLDATACOPY:
+		// Copying the selector to scratch memory
+		return d.isConstant(statement.Inputs[1], 0) && d.isConstant(statement.Inputs[2], 4)
+	case MLOAD:
+		return d.isConstant(statement.Inputs[0], 0)
+	}
+	return statement.isPure() && statement.Op.reads() == 0
+}
+
+// Returns true if the statements only reject the call
+func (ssa *SSAProgram) rejects(block *StatementBlock, start int) bool {
+	if block == ssa.ErrorBlock {
+		return true
+	}
+	for _, statement := range block.Statements[start:] {
+		switch {
+		case statement.Op == REVERT || statement.Op == INVALID:
+			return true
+		case statement.Op == JUMP:
+			return block.NextBlock == ssa.ErrorBlock
+		case statement.Op == JUMPDEST || statement.isPure():
+		default:
+			return false
+		}
+	}
+	return block.NextBlock != nil && ssa.rejects(block.NextBlock, 0)
+}
+
+// The index of the statement after the first conditional jumps of the
+// block. Unlike statement indices, it is not changed by later passes.
+func (block *StatementBlock) afterJumps(jumps int) int {
+	for i, statement := range block.Statements {
+		if jumps == 0 {
+			return i
+		}
+		if statement.Op == JUMPI {
+			jumps--
+		}
+	}
+	return len(block.Statements)
+}
+
+// Adds a function starting after the conditional jumps of the block,
+// unless it only rejects the call. Payable is false if the dispatch code
+// leading to the block rejected value.
+func (d *dispatcherAnalysis) add(kind FunctionKind, selector uint32, block *StatementBlock, skip int, payable bool) {
+	if block == nil {
+		return
+	}
+	start := block.afterJumps(skip)
+	if d.ssa.rejects(block, start) {
+		return
+	}
+	if kind != PublicFunctionKind {
+		for _, function := range d.dispatcher.Functions {
+			if function.Kind == kind || (function.Entry == block && function.Skip == skip) {
+				return
+			}
+		}
+	}
+	function := &PublicFunction{
+		Kind:     kind,
+		Selector: selector,
+		Entry:    block,
+		Skip:     skip,
+		Payable:  payable && d.ssa.acceptsValue(block, start),
+	}
+	if kind == PublicFunctionKind {
+		d.dispatcher.Selectors[selector] = block
+	}
+	d.entries[block] = true
+	d.dispatcher.Functions = append(d.dispatcher.Functions, function)
+}
+
+// Walks the dispatch code in a block. Blocks reached by range checks
+// dispatch further, code that does not dispatch is the fallback function,
+// or the receive function if it runs for empty call data. Payable is false
+// once the dispatch code rejected value.
+func (d *dispatcherAnalysis) walk(block *StatementBlock, kind FunctionKind, payable bool) {
+	if block == nil || block == d.ssa.ErrorBlock || d.visited[block] || d.entries[block] {
+		return
+	}
+	d.visited[block] = true
+	condition := 0
+	for i, statement := range block.Statements {
+		if !d.isDispatch(statement) {
+			d.add(kind, 0, block, condition, payable)
+			return
+		}
+		if statement.Op != JUMPI {
+			continue
+		}
+		var target *StatementBlock
+		if condition < len(block.CondBlocks) {
+			target = block.CondBlocks[condition]
+		}
+		condition++
+		last := i == len(block.Statements) - 1
+		
+		cond := statement.Inputs[1]
+		selector, equal, ok := d.selectorComparison(cond)
+		switch {
+		case ok && equal:
+			d.add(PublicFunctionKind, selector, target, 0, payable)
+		case ok && last:
+			// Jumps to the next comparison, the function follows
+			d.add(PublicFunctionKind, selector, block.NextBlock, 0, payable)
+			d.walk(target, kind, payable)
+			return
+		case ok:
+			d.add(PublicFunctionKind, selector, block, condition, payable)
+			d.walk(target, kind, payable)
+			return
+		case d.isSelectorRange(cond):
+			d.walk(target, kind, payable)
+		case d.uses(cond, CALLVALUE):
+			// Rejecting value for the functions dispatched after it
+			payable = false
+			d.walk(target, kind, payable)
+		case d.uses(cond, CALLDATASIZE):
+			// Jumping if there is call data, or if it is too short for
+			// a selector. Empty call data is received.
+			if op, _, _ := d.operation(cond); op == CALLDATASIZE {
+				d.walk(target, FallbackFunctionKind, payable)
+				kind = ReceiveFunctionKind
+			} else if op == ISZERO {
+				d.walk(target, ReceiveFunctionKind, payable)
+			} else {
+				d.walk(target, FallbackFunctionKind, payable)
+			}
+		default:
+			d.walk(target, kind, payable)
+		}
+	}
+	d.dispatcher.Blocks[block] = true
+	
+	// Continue with the code after the last comparison
+	if n := len(block.Statements); n == 0 || !block.Statements[n - 1].Op.IsControlFlow() ||
+		block.Statements[n - 1].Op == JUMP || block.Statements[n - 1].Op == JUMPI {
+		d.walk(block.NextBlock, kind, payable)
+	}
+	for _, target := range block.JumpTargets {
+		d.walk(target, kind, payable)
+	}
+}
+
+// Returns false if the function starts by rejecting calls with value
+func (ssa *SSAProgram) acceptsValue(block *StatementBlock, start int) bool {
+	d := &dispatcherAnalysis{ssa: ssa, definitions: ssa.definitions()}
+	for _, statement := range block.Statements[start:] {
+		if statement.Op == JUMPI {
+			return !d.uses(statement.Inputs[1], CALLVALUE)
+		}
+		if !d.isDispatch(statement) {
+			return true
+		}
+	}
+	return true
+}
+
+func (ssa *SSAProgram) definitions() map[string]*Statement {
+	definitions := make(map[string]*Statement)
+	for _, block := range ssa.Blocks {
+		for _, statement := range block.Statements {
+			if statement.Output != nil {
+				definitions[statement.Output.Label] = statement
+			}
+		}
+	}
+	return definitions
+}
+
+// Recognizes the dispatcher at the entry of the program: the comparisons
+// of the selector with constants, linear or as a binary search, and the
+// fallback and receive functions. A program without a dispatcher is all
+// fallback function.
+func (ssa *SSAProgram) FindDispatcher() *Dispatcher {
+	d := &dispatcherAnalysis{
+		ssa:         ssa,
+		definitions: ssa.definitions(),
+		dispatcher:  &Dispatcher{
+			Selectors: make(map[uint32]*StatementBlock),
+			Functions: make([]*PublicFunction, 0),
+			Blocks:    make(map[*StatementBlock]bool),
+		},
+		visited:     make(map[*StatementBlock]bool),
+		entries:     make(map[*StatementBlock]bool),
+	}
+	if len(ssa.Blocks) == 0 {
+		return d.dispatcher
+	}
+	d.walk(ssa.Blocks[0], FallbackFunctionKind, true)
+	if len(d.dispatcher.Selectors) == 0 {
+		d.dispatcher.Functions = make([]*PublicFunction, 0)
+		d.dispatcher.Blocks = make(map[*StatementBlock]bool)
+		d.add(FallbackFunctionKind, 0, ssa.Blocks[0], 0, true)
+	}
+	return d.dispatcher
+}
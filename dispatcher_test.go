@@ -0,0 +1,80 @@
+package evmdis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFindDispatcher(t *testing.T) {
+	kinds := map[FunctionKind]string{
+		PublicFunctionKind:   "function",
+		FallbackFunctionKind: "fallback",
+		ReceiveFunctionKind:  "receive",
+	}
+	tests := []struct {
+		name     string
+		code     string
+		expected []string
+	}{
+		{
+			// solc 0.4, the selector is the first word divided by 2²²⁴
+			// and transfer rejects value
+			"div",
+			dispatcher + "6001600055" + "00",
+			[]string{"function a9059cbb"},
+		},
+		{
+			// solc 0.8, the selector is the first word shifted right by
+			// 224 bits and the second function rejects value
+			"shr",
+			"608060405260003560e01c80631111111114610025578063222222221461002c57600080fd" +
+				"5b6001600055005b34801561003857600080fd5b50600260005500",
+			[]string{"function 11111111 payable", "function 22222222"},
+		},
+		{
+			// Selectors above 0x50000000 are compared after a check for
+			// value, which is walked first
+			"binary search",
+			"608060405260003560e01c806350000000116100305780631111111114610058578063222222221461005f" +
+				"57600080fd5b34801561003c57600080fd5b5080636666666614610066578063777777771461006d" +
+				"57600080fd5b6001600055005b6002600055005b6003600055005b600460005500",
+			[]string{"function 66666666", "function 77777777", "function 11111111 payable",
+				"function 22222222 payable"},
+		},
+		{
+			// Vyper copies the selector to memory and jumps to the next
+			// comparison if it differs
+			"vyper",
+			"60046000601c376000516311111111811861001b576001600055005b6322222222811861002d57600260005500" +
+				"5b600080fd",
+			[]string{"function 11111111 payable", "function 22222222 payable"},
+		},
+		{
+			"fallback only",
+			"600160005500",
+			[]string{"fallback 00000000 payable"},
+		},
+		{
+			// Call data shorter than a selector is received if it is
+			// empty, else it is the fallback function
+			"receive and fallback",
+			"60806040526004361061001e5760003560e01c80631111111114610032575b361561002b576003600055005b" +
+				"6002600055005b600160005500",
+			[]string{"receive 00000000 payable", "fallback 00000000 payable", "function 11111111 payable"},
+		},
+	}
+	for _, test := range tests {
+		functions := make([]string, 0)
+		for _, function := range recoverContract(t, test.code).PublicFunctions {
+			str := fmt.Sprintf("%v %08x", kinds[function.Kind], function.Selector)
+			if function.Payable {
+				str += " payable"
+			}
+			functions = append(functions, str)
+		}
+		if strings.Join(functions, ", ") != strings.Join(test.expected, ", ") {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, functions)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package evmdis
+
+import (
+	"sort"
+)
+
+// The virtual node all exits of the program lead to, the root of the
+// post-dominator tree
+type exitNode struct {
+}
+
+var ExitNode Node = &exitNode{}
+
+// A dominator or post-dominator tree. Nodes that are not reachable from
+// the root (or cannot reach the exit, for post-dominators) are not in
+// the tree.
+type DominatorTree struct {
+	Root            Node
+	Idom            map[Node]Node   // Immediate dominator, nil for the root
+	Children        map[Node][]Node
+	order           map[Node]int    // Reverse postorder number
+	predecessors    func(node Node) []Node
+}
+
+// Computes the dominators with the iterative algorithm of Cooper, Harvey
+// and Kennedy on the reverse postorder.
+func newDominatorTree(root Node, successors func(node Node) []Node, predecessors func(node Node) []Node) *DominatorTree {
+	tree := &DominatorTree{
+		Root:         root,
+		Idom:         make(map[Node]Node),
+		Children:     make(map[Node][]Node),
+		order:        make(map[Node]int),
+		predecessors: predecessors,
+	}
+	if root == nil {
+		return tree
+	}
+	
+	postorder := make([]Node, 0)
+	depthFirst(root, successors, nil, func(node Node) {
+		postorder = append(postorder, node)
+	})
+	rpo := make([]Node, len(postorder))
+	for i, node := range postorder {
+		rpo[len(postorder) - 1 - i] = node
+		tree.order[node] = len(postorder) - 1 - i
+	}
+	
+	// Walks up from both nodes until they meet
+	intersect := func(a Node, b Node) Node {
+		for a != b {
+			for tree.order[a] > tree.order[b] {
+				a = tree.Idom[a]
+			}
+			for tree.order[b] > tree.order[a] {
+				b = tree.Idom[b]
+			}
+		}
+		return a
+	}
+	
+	tree.Idom[root] = root
+	for changed := true; changed; {
+		changed = false
+		for _, node := range rpo[1:] {
+			var idom Node
+			for _, predecessor := range predecessors(node) {
+				if _, ok := tree.Idom[predecessor]; !ok {
+					continue
+				}
+				if idom == nil {
+					idom = predecessor
+				} else {
+					idom = intersect(predecessor, idom)
+				}
+			}
+			if tree.Idom[node] != idom {
+				tree.Idom[node] = idom
+				changed = true
+			}
+		}
+	}
+	
+	tree.Idom[root] = nil
+	for _, node := range rpo[1:] {
+		idom := tree.Idom[node]
+		tree.Children[idom] = append(tree.Children[idom], node)
+	}
+	return tree
+}
+
+func (cfg *CFG) Dominators() *DominatorTree {
+	return newDominatorTree(cfg.Entry, cfg.SuccessorNodes, cfg.PredecessorNodes)
+}
+
+// Computes the post-dominators. All nodes without successors lead to
+// the virtual ExitNode, which is the root of the tree.
+func (cfg *CFG) PostDominators() *DominatorTree {
+	exits := make([]Node, 0)
+	for _, node := range cfg.Nodes {
+		if len(cfg.successors[node]) == 0 {
+			exits = append(exits, node)
+		}
+	}
+	
+	// The reverse graph
+	successors := func(node Node) []Node {
+		if node == ExitNode {
+			return exits
+		}
+		return cfg.PredecessorNodes(node)
+	}
+	predecessors := func(node Node) []Node {
+		if len(cfg.successors[node]) == 0 {
+			return []Node{ExitNode}
+		}
+		return cfg.SuccessorNodes(node)
+	}
+	return newDominatorTree(ExitNode, successors, predecessors)
+}
+
+func (tree *DominatorTree) Contains(node Node) bool {
+	_, ok := tree.order[node]
+	return ok
+}
+
+// Returns true if every path from the root to b passes through a. Every
+// node dominates itself.
+func (tree *DominatorTree) Dominates(a Node, b Node) bool {
+	if !tree.Contains(a) || !tree.Contains(b) {
+		return false
+	}
+	for ; b != nil; b = tree.Idom[b] {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (tree *DominatorTree) StrictlyDominates(a Node, b Node) bool {
+	return a != b && tree.Dominates(a, b)
+}
+
+// The closest node that dominates both nodes, nil if either is not in
+// the tree
+func (tree *DominatorTree) NearestCommonDominator(a Node, b Node) Node {
+	if !tree.Contains(a) || !tree.Contains(b) {
+		return nil
+	}
+	dominators := make(map[Node]bool)
+	for ; a != nil; a = tree.Idom[a] {
+		dominators[a] = true
+	}
+	for ; b != nil; b = tree.Idom[b] {
+		if dominators[b] {
+			return b
+		}
+	}
+	return nil
+}
+
+// The dominance frontier of every node: the nodes where its dominance
+// ends. For a post-dominator tree these are the nodes it is control
+// dependent on.
+func (tree *DominatorTree) Frontiers() map[Node][]Node {
+	frontiers := make(map[Node][]Node)
+	for node := range tree.order {
+		predecessors := make([]Node, 0)
+		for _, predecessor := range tree.predecessors(node) {
+			if tree.Contains(predecessor) {
+				predecessors = append(predecessors, predecessor)
+			}
+		}
+		if len(predecessors) < 2 {
+			continue
+		}
+		for _, predecessor := range predecessors {
+			for runner := predecessor; runner != nil && runner != tree.Idom[node]; runner = tree.Idom[runner] {
+				if !containsNode(frontiers[runner], node) {
+					frontiers[runner] = append(frontiers[runner], node)
+				}
+			}
+		}
+	}
+	for node := range frontiers {
+		tree.sort(frontiers[node])
+	}
+	return frontiers
+}
+
+// Sorts nodes in reverse postorder
+func (tree *DominatorTree) sort(nodes []Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return tree.order[nodes[i]] < tree.order[nodes[j]]
+	})
+}
+
+func containsNode(nodes []Node, node Node) bool {
+	for _, other := range nodes {
+		if other == node {
+			return true
+		}
+	}
+	return false
+}
+
+// A natural loop: the nodes that can reach a back edge to the header
+// without passing through the header.
+type Loop struct {
+	Header          Node
+	Body            []Node  // In reverse postorder, starting with the header
+	BackEdges       []*Edge // Edges from the body to the header
+	Exits           []*Edge // Edges from the body to outside the loop
+	Parent          *Loop   // The innermost enclosing loop
+}
+
+func (loop *Loop) Contains(node Node) bool {
+	return containsNode(loop.Body, node)
+}
+
+func (loop *Loop) Depth() int {
+	depth := 1
+	for parent := loop.Parent; parent != nil; parent = parent.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Finds the natural loops. Back edges to the same header form a single
+// loop. Loops are ordered by header in reverse postorder, so enclosing
+// loops come first.
+func (cfg *CFG) Loops(dominators *DominatorTree) []*Loop {
+	headers := make([]Node, 0)
+	loops := make(map[Node]*Loop)
+	for _, node := range cfg.Nodes {
+		for _, edge := range cfg.successors[node] {
+			if !dominators.Dominates(edge.To, edge.From) {
+				continue
+			}
+			loop, ok := loops[edge.To]
+			if !ok {
+				loop = &Loop{Header: edge.To}
+				loops[edge.To] = loop
+				headers = append(headers, edge.To)
+			}
+			loop.BackEdges = append(loop.BackEdges, edge)
+		}
+	}
+	dominators.sort(headers)
+	
+	result := make([]*Loop, 0)
+	for _, header := range headers {
+		loop := loops[header]
+		
+		// Walk backwards from the back edges up to the header
+		body := map[Node]bool{header: true}
+		work := make([]Node, 0)
+		for _, edge := range loop.BackEdges {
+			if !body[edge.From] {
+				body[edge.From] = true
+				work = append(work, edge.From)
+			}
+		}
+		for len(work) > 0 {
+			node := work[len(work) - 1]
+			work = work[:len(work) - 1]
+			for _, predecessor := range cfg.PredecessorNodes(node) {
+				if !body[predecessor] && dominators.Contains(predecessor) {
+					body[predecessor] = true
+					work = append(work, predecessor)
+				}
+			}
+		}
+		for node := range body {
+			loop.Body = append(loop.Body, node)
+		}
+		dominators.sort(loop.Body)
+		
+		for _, node := range loop.Body {
+			for _, edge := range cfg.successors[node] {
+				if !body[edge.To] {
+					loop.Exits = append(loop.Exits, edge)
+				}
+			}
+		}
+		
+		// The innermost enclosing loop was found before this one
+		for i := len(result) - 1; i >= 0; i-- {
+			if result[i].Contains(header) {
+				loop.Parent = result[i]
+				break
+			}
+		}
+		result = append(result, loop)
+	}
+	return result
+}
+
+func (ssa *SSAProgram) Dominators() *DominatorTree {
+	if ssa.CFG == nil {
+		ssa.ComputeIncoming()
+	}
+	return ssa.CFG.Dominators()
+}
+
+func (ssa *SSAProgram) PostDominators() *DominatorTree {
+	if ssa.CFG == nil {
+		ssa.ComputeIncoming()
+	}
+	return ssa.CFG.PostDominators()
+}
+
+func (ssa *SSAProgram) Loops() []*Loop {
+	// Computing the dominators builds the graph if it is missing
+	dominators := ssa.Dominators()
+	return ssa.CFG.Loops(dominators)
+}
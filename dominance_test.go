@@ -0,0 +1,140 @@
+package evmdis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Builds a graph from edges written as "from to", the entry is the source
+// of the first edge
+func graph(edges ...string) *CFG {
+	var cfg *CFG
+	for _, edge := range edges {
+		nodes := strings.Fields(edge)
+		if cfg == nil {
+			cfg = NewCFG(nodes[0])
+		}
+		cfg.AddEdge(nodes[0], nodes[1], JumpEdge)
+	}
+	return cfg
+}
+
+func labels(nodes []Node) string {
+	strs := make([]string, len(nodes))
+	for i, node := range nodes {
+		strs[i] = nodeLabel(node)
+	}
+	return strings.Join(strs, " ")
+}
+
+// The immediate dominator of every node as "node:idom", sorted
+func idoms(tree *DominatorTree) string {
+	strs := make([]string, 0)
+	for node, idom := range tree.Idom {
+		if idom != nil {
+			strs = append(strs, fmt.Sprintf("%v:%v", nodeLabel(node), nodeLabel(idom)))
+		}
+	}
+	sort.Strings(strs)
+	return strings.Join(strs, " ")
+}
+
+// The frontier of every node as "node:frontier", sorted
+func frontiers(tree *DominatorTree) string {
+	strs := make([]string, 0)
+	for node, frontier := range tree.Frontiers() {
+		strs = append(strs, fmt.Sprintf("%v:%v", nodeLabel(node), strings.Replace(labels(frontier), " ", ",", -1)))
+	}
+	sort.Strings(strs)
+	return strings.Join(strs, " ")
+}
+
+var (
+	diamond   = []string{"a b", "a c", "b d", "c d"}
+	nested    = []string{"a b", "b c", "c d", "d c", "d e", "e b", "e f"}
+	// The cycle between b and c is entered at both nodes
+	irreducible = []string{"a b", "a c", "b c", "c b", "b d"}
+)
+
+func TestDominators(t *testing.T) {
+	tests := []struct {
+		name      string
+		edges     []string
+		expected  string
+		frontiers string
+	}{
+		{"diamond", diamond, "b:a c:a d:a", "b:d c:d"},
+		{"nested", nested, "b:a c:b d:c e:d f:e", "b:b c:b,c d:b,c e:b"},
+		{"irreducible", irreducible, "b:a c:a d:b", "b:c c:b"},
+	}
+	for _, test := range tests {
+		tree := graph(test.edges...).Dominators()
+		if str := idoms(tree); str != test.expected {
+			t.Errorf("%v: expected dominators %v, got %v", test.name, test.expected, str)
+		}
+		if str := frontiers(tree); str != test.frontiers {
+			t.Errorf("%v: expected frontiers %v, got %v", test.name, test.frontiers, str)
+		}
+	}
+}
+
+func TestPostDominators(t *testing.T) {
+	tests := []struct {
+		name      string
+		edges     []string
+		expected  string
+		frontiers string
+	}{
+		{"diamond", diamond, "a:d b:d c:d d:exit", "b:a c:a"},
+		{"nested", nested, "a:b b:c c:d d:e e:f f:exit", "b:e c:e,d d:e,d e:e"},
+		{"irreducible", irreducible, "a:b b:d c:b d:exit", "b:b c:b,a"},
+	}
+	for _, test := range tests {
+		tree := graph(test.edges...).PostDominators()
+		if str := idoms(tree); str != test.expected {
+			t.Errorf("%v: expected post-dominators %v, got %v", test.name, test.expected, str)
+		}
+		if str := frontiers(tree); str != test.frontiers {
+			t.Errorf("%v: expected frontiers %v, got %v", test.name, test.frontiers, str)
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		name     string
+		edges    []string
+		expected []string
+	}{
+		{"diamond", diamond, []string{}},
+		{"nested", nested, []string{"b [b c d e] exits [e f] depth 1", "c [c d] exits [d e] depth 2"}},
+		{"irreducible", irreducible, []string{}},
+		{"self loop", []string{"a b", "b b", "b c"}, []string{"b [b] exits [b c] depth 1"}},
+	}
+	for _, test := range tests {
+		cfg := graph(test.edges...)
+		loops := make([]string, 0)
+		for _, loop := range cfg.Loops(cfg.Dominators()) {
+			exits := make([]string, len(loop.Exits))
+			for i, edge := range loop.Exits {
+				exits[i] = nodeLabel(edge.From) + " " + nodeLabel(edge.To)
+			}
+			loops = append(loops, fmt.Sprintf("%v [%v] exits [%v] depth %v", nodeLabel(loop.Header),
+				labels(loop.Body), strings.Join(exits, ", "), loop.Depth()))
+		}
+		if strings.Join(loops, "; ") != strings.Join(test.expected, "; ") {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, loops)
+		}
+	}
+}
+
+func TestProgramLoopsWithoutCFG(t *testing.T) {
+	// An endless loop: JUMPDEST, JUMP(0x0)
+	ssa := compileSSA(t, "5b600056")
+	ssa.CFG = nil
+	if loops := ssa.Loops(); len(loops) != 1 {
+		t.Errorf("expected one loop, got %v", len(loops))
+	}
+}
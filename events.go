@@ -0,0 +1,145 @@
+package evmdis
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// An event the contract emits, identified by the hash of its signature
+type Event struct {
+	Expression
+	Topic           *big.Int
+	Signature       string   // Empty if the topic was not resolved
+	Types           []string // The parameters in the order they are declared
+	Indexed         []bool
+}
+
+func (event *Event) Name() string {
+	if event.Signature == "" {
+		return fmt.Sprintf("Event_%08x", new(big.Int).Rsh(event.Topic, 224))
+	}
+	name, _ := splitSignature(event.Signature)
+	return name
+}
+
+func (event *Event) Declaration() string {
+	parameters := make([]string, len(event.Types))
+	for i, parameterType := range event.Types {
+		parameters[i] = parameterType
+		if event.Indexed[i] {
+			parameters[i] += " indexed"
+		}
+	}
+	return fmt.Sprintf("event %v(%v);", event.Name(), strings.Join(parameters, ", "))
+}
+
+// The event a log statement is recovered as emitting, followed by the
+// arguments
+func emittedEvent(op OpCode, inputs []Expression) (*Event, bool) {
+	if op < LOG0 || op > LOG4 || len(inputs) == 0 {
+		return nil, false
+	}
+	event, ok := inputs[0].(*Event)
+	return event, ok
+}
+
+func renderEmit(event *Event, arguments []Expression) string {
+	str := fmt.Sprintf("emit %v(", event.Name())
+	for i, argument := range arguments {
+		if i > 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("%v", argument)
+	}
+	return str + ")"
+}
+
+// The type of a parameter from the value passed for it, as an indexed
+// topic or the argument of a call
+func (r *returnDecoder) parameterType(value Expression) string {
+	if statement := r.definition(value); statement != nil {
+		switch statement.Op {
+		case CALLER, ORIGIN, ADDRESS, COINBASE:
+			return "address"
+		}
+	}
+	return r.valueType(value)
+}
+
+// Recovers the events from log statements whose first topic is constant.
+// The topic is resolved with the signature database, the data is decoded
+// like returned data. Unresolved events declare the indexed parameters
+// first. Must run after Simplify, which turns masks into casts.
+func (ssa *SSAProgram) RecoverEvents() {
+	if ssa.Signatures == nil {
+		ssa.Signatures = NewSignatureDatabase()
+	}
+	r := &returnDecoder{
+		memoryAnalysis: ssa.memoryAnalysis(),
+		types:          ssa.typeInference(),
+		decoded:        make(map[*Statement][]string),
+		stores:         make(map[*Statement]bool),
+	}
+	events := make(map[string]*Event)
+	ssa.Events = make([]*Event, 0)
+	emits := make(map[*Statement][]Expression)
+	for _, block := range ssa.Blocks {
+		for i, statement := range block.Statements {
+			if statement.Op < LOG1 || statement.Op > LOG4 {
+				continue
+			}
+			topic, ok := statement.Inputs[2].(Constant)
+			if !ok {
+				continue
+			}
+			values, types, ok := r.decode(block, i)
+			if !ok {
+				continue
+			}
+			topics := statement.Inputs[3:]
+			
+			event, ok := events[topic.Value.String()]
+			if !ok {
+				event = &Event{Topic: topic.Value}
+				for _, topic := range topics {
+					event.Types = append(event.Types, r.parameterType(topic))
+					event.Indexed = append(event.Indexed, true)
+				}
+				for _, valueType := range types {
+					event.Types = append(event.Types, valueType)
+					event.Indexed = append(event.Indexed, false)
+				}
+				
+				// The signature must index a parameter for every topic
+				// after the first and agree with the words of data
+				signature, indexed, resolved := ssa.Signatures.ResolveEvent(topic.Value, len(topics))
+				_, signatureTypes := splitSignature(signature)
+				if resolved && len(signatureTypes) == len(event.Types) {
+					event.Signature = signature
+					event.Types = signatureTypes
+					event.Indexed = indexed
+				}
+				events[topic.Value.String()] = event
+				ssa.Events = append(ssa.Events, event)
+			}
+			
+			// The arguments in the order of the parameters
+			arguments := []Expression{event}
+			for _, isIndexed := range event.Indexed {
+				if isIndexed && len(topics) > 0 {
+					arguments, topics = append(arguments, topics[0]), topics[1:]
+				} else if !isIndexed && len(values) > 0 {
+					arguments, values = append(arguments, values[0]), values[1:]
+				}
+			}
+			emits[statement] = arguments
+		}
+	}
+	
+	// Remove the stores of the data and emit the events
+	r.remove(r.stores)
+	for statement, arguments := range emits {
+		statement.Inputs = arguments
+	}
+}
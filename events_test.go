@@ -0,0 +1,58 @@
+package evmdis
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Pushes the topic of the event
+func pushTopic(signature string) string {
+	hash := Keccak256([]byte(signature))
+	return "7f" + hex.EncodeToString(hash[:])
+}
+
+func TestRecoverEventsIndexed(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		{
+			// URI(msg.data[4] as 3 bytes, msg.data[0x24])
+			"indexed last",
+			"6020600052" + "6003602052" + "600435604052" + "602435" + pushTopic("URI(string,uint256)") +
+				"60606000a2" + "00",
+			[]string{"event URI(string, uint256 indexed);", "emit URI(bytes(0x20), uint(bytes32(msg.data[0x24:])));"},
+		},
+		{
+			// ERC-20 Transfer(msg.sender, msg.data[4], 1)
+			"fungible",
+			"6001600052" + "600435" + "33" + pushTopic("Transfer(address,address,uint256)") +
+				"60206000a3" + "00",
+			[]string{"event Transfer(address indexed, address indexed, uint256);"},
+		},
+		{
+			// ERC-721 Transfer(msg.sender, msg.data[4], 1)
+			"non-fungible",
+			"6001" + "600435" + "33" + pushTopic("Transfer(address,address,uint256)") +
+				"60006000a4" + "00",
+			[]string{"event Transfer(address indexed, address indexed, uint256 indexed);"},
+		},
+		{
+			// Paused(msg.sender) with the account indexed, which no
+			// declaration does
+			"mismatch",
+			"33" + pushTopic("Paused(address)") + "60006000a2" + "00",
+			[]string{"event Event_62e78cea(address indexed);"},
+		},
+	}
+	for _, test := range tests {
+		contract := decompile(t, dispatcher + test.body)
+		for _, expected := range test.expected {
+			if !strings.Contains(contract, expected) {
+				t.Errorf("%v: expected %q, got\n%v", test.name, expected, contract)
+			}
+		}
+	}
+}
@@ -2,14 +2,37 @@ package main
 
 import (
 	"encoding/hex"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	".."
 )
 
 func main() {
+	forkName := flag.String("fork", evmdis.LatestFork.String(),
+		"instruction set to disassemble with (frontier, homestead, byzantium, constantinople, istanbul, london, paris, shanghai, cancun)")
+	kindName := flag.String("mode", evmdis.AutoCode.String(),
+		"kind of bytecode on stdin (auto, creation, runtime)")
+	recursive := flag.Bool("recursive", false,
+		"decompile only the code reachable from the entry point")
+	yul := flag.Bool("yul", false,
+		"write inline assembly (Yul) that recompiles instead of Solidity")
+	signatures := flag.String("signatures", "",
+		"comma separated files with function and event signatures or contract ABIs (JSON) to resolve selectors and topics with")
+	flag.Parse()
+	
+	fork, err := evmdis.ForkByName(*forkName)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	kind, err := evmdis.CodeKindByName(*kindName)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	
 	hexdata, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
 	    log.Fatalf("Could not read from stdin: %v", err)
@@ -19,18 +42,71 @@ func main() {
 	bytecode := make([]byte, hex.DecodedLen(len(hexdata)))
 	hex.Decode(bytecode, hexdata)
 	
-	fmt.Printf("# NewProgram\n")
-	program := evmdis.NewProgram(bytecode)
-	program.ParseCreation()
+	fmt.Printf("# Disassemble (%v, %v)\n", fork, kind)
+	creation, program, err := evmdis.Disassemble(bytecode, fork, kind)
+	if err != nil {
+		log.Fatalf("Could not disassemble: %v", err)
+	}
+	if creation != nil {
+		fmt.Printf("# Creation\n")
+		creation.PrintAssembler()
+		creation.PrintDiagnostics()
+		fmt.Printf("# Runtime\n")
+	}
 	program.PrintAssembler()
 	
+	fmt.Printf("# Diagnostics\n")
+	program.PrintDiagnostics()
+	
+	if *recursive {
+		program = program.RecursiveDescent()
+	}
+	
 	fmt.Printf("# StackLabel\n")
 	ssa := evmdis.CompileSSA(program)
 	ssa.ComputeJumpTargets()
 	ssa.ComputeIncoming()
+	for _, jump := range ssa.ResolveJumps() {
+		fmt.Printf("# Dynamic jump %v\n", jump)
+	}
 	ssa.CollapseJumps()
-	ssa.LabelFunctions()
+	ssa.RecoverFunctions()
+	for _, function := range ssa.Functions {
+		fmt.Printf("# Function %v\n", function)
+	}
+	ssa.ConstructSSA()
+	ssa.Signatures = evmdis.NewSignatureDatabase()
+	if *signatures != "" {
+		for _, path := range strings.Split(*signatures, ",") {
+			if err := ssa.Signatures.LoadFile(path); err != nil {
+				log.Fatalf("Could not load signatures from %v: %v", path, err)
+			}
+		}
+	}
+	if !*yul {
+		ssa.LabelFunctions()
+	}
+	ssa.Simplify()
+	ssa.DecodeReturns()
+	if !*yul {
+		ssa.RecoverStorage()
+		ssa.RecoverEvents()
+		ssa.RecoverMemory()
+		ssa.RecoverCalls()
+	}
+	ssa.InferArgumentTypes()
+	statements, blocks := ssa.EliminateDeadCode()
+	fmt.Printf("# Dead code: %v statements, %v blocks\n", statements, blocks)
+	ssa.FoldExpressions()
 	ssa.PrintSSA()
 	
-	fmt.Printf(ssa.Contract())
+	if *yul {
+		fmt.Print(ssa.Yul())
+	} else {
+		fmt.Printf("# ABI\n")
+		for _, line := range strings.Split(ssa.ABI(), "\n") {
+			fmt.Printf("# %v\n", line)
+		}
+		fmt.Print(ssa.Contract())
+	}
 }
@@ -0,0 +1,227 @@
+package evmdis
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// An abstract stack or memory value during exploration. Either a known
+// constant or an opaque value identified by a unique number.
+type abstractValue struct {
+	Value           *big.Int
+	Id              int
+}
+
+func (value abstractValue) Key() string {
+	if value.Value != nil {
+		return fmt.Sprintf("0x%x", value.Value)
+	}
+	return fmt.Sprintf("v%v", value.Id)
+}
+
+type abstractState struct {
+	Block           *BasicBlock
+	Stack           []abstractValue
+	Memory          map[string]abstractValue
+	Copies          map[string]Region // CODECOPY destinations in memory
+}
+
+// Identifies states that behave the same, opaque values are not
+// distinguished.
+func (state *abstractState) signature() string {
+	keys := make([]string, len(state.Stack))
+	for i, value := range state.Stack {
+		if value.Value != nil {
+			keys[i] = value.Key()
+		} else {
+			keys[i] = "?"
+		}
+	}
+	return fmt.Sprintf("%v:%v", state.Block.Offset, strings.Join(keys, ","))
+}
+
+// Bounds on the number of distinct states explored
+const (
+	maxExploreVisits = 64
+	maxExploreStates = 100000
+)
+
+// Executes the program abstractly from the entry point, following every
+// jump with a known constant target and both sides of conditional jumps.
+// The visit function is called for every instruction that is not a stack
+// manipulation, with its arguments in stack order. Exploration stops
+// when visit returns true. Returns the blocks that were executed.
+func (program *Program) explore(visit func(state *abstractState, instruction *Instruction, args []abstractValue) bool) map[*BasicBlock]bool {
+	reached := make(map[*BasicBlock]bool)
+	if len(program.Blocks) == 0 {
+		return reached
+	}
+	blocks := make(map[int]*BasicBlock)
+	for _, block := range program.Blocks {
+		blocks[block.Offset] = block
+	}
+	
+	ids := 0
+	unknown := func() abstractValue {
+		ids++
+		return abstractValue{Id: ids}
+	}
+	
+	seen := make(map[string]bool)
+	visits := make(map[int]int)
+	work := []*abstractState{{
+		Block:  program.Blocks[0],
+		Stack:  make([]abstractValue, 0),
+		Memory: make(map[string]abstractValue),
+		Copies: make(map[string]Region),
+	}}
+	for len(work) > 0 && len(seen) < maxExploreStates {
+		state := work[len(work) - 1]
+		work = work[:len(work) - 1]
+		signature := state.signature()
+		if seen[signature] || visits[state.Block.Offset] >= maxExploreVisits {
+			continue
+		}
+		seen[signature] = true
+		visits[state.Block.Offset]++
+		reached[state.Block] = true
+		
+		// Pops a value, values below the known stack are opaque
+		pop := func() abstractValue {
+			n := len(state.Stack)
+			if n == 0 {
+				return unknown()
+			}
+			value := state.Stack[n - 1]
+			state.Stack = state.Stack[:n - 1]
+			return value
+		}
+		peek := func(depth int) abstractValue {
+			for len(state.Stack) < depth {
+				state.Stack = append([]abstractValue{unknown()}, state.Stack...)
+			}
+			return state.Stack[len(state.Stack) - depth]
+		}
+		next := func(offset int, jump bool) {
+			block, ok := blocks[offset]
+			if !ok || (jump && !program.JumpDests.IsValid(offset)) {
+				return
+			}
+			work = append(work, &abstractState{
+				Block:  block,
+				Stack:  append([]abstractValue{}, state.Stack...),
+				Memory: copyValues(state.Memory),
+				Copies: copyRegions(state.Copies),
+			})
+		}
+		
+		continues := true
+		for i := range state.Block.Instructions {
+			instruction := &state.Block.Instructions[i]
+			op := instruction.Op
+			switch {
+			case op == PUSH0:
+				state.Stack = append(state.Stack, abstractValue{Value: big.NewInt(0)})
+				continue
+			case op.IsPush():
+				state.Stack = append(state.Stack, abstractValue{Value: instruction.Arg})
+				continue
+			case op.IsDup():
+				state.Stack = append(state.Stack, peek(op.OperandSuffix()))
+				continue
+			case op.IsSwap():
+				n := op.OperandSuffix() + 1
+				peek(n)
+				top := len(state.Stack) - 1
+				state.Stack[top], state.Stack[top + 1 - n] =
+					state.Stack[top + 1 - n], state.Stack[top]
+				continue
+			}
+			
+			args := make([]abstractValue, op.StackReads())
+			for i := range args {
+				args[i] = pop()
+			}
+			if visit(state, instruction, args) {
+				return reached
+			}
+			
+			switch op {
+			case MSTORE:
+				state.Memory[args[0].Key()] = args[1]
+			case CODECOPY:
+				offset, size := args[1].Value, args[2].Value
+				if offset != nil && size != nil && offset.IsInt64() && size.IsInt64() &&
+					offset.Int64() + size.Int64() <= int64(len(program.Code)) {
+					state.Copies[args[0].Key()] = Region{
+						Kind:   RuntimeRegion,
+						Offset: int(offset.Int64()),
+						Size:   int(size.Int64()),
+					}
+				}
+			case JUMP:
+				if target := args[0].Value; target != nil && target.IsInt64() {
+					next(int(target.Int64()), true)
+				}
+			case JUMPI:
+				target, condition := args[0].Value, args[1].Value
+				if target != nil && target.IsInt64() && (condition == nil || condition.Sign() != 0) {
+					next(int(target.Int64()), true)
+				}
+				if condition != nil && condition.Sign() != 0 {
+					continues = false
+				}
+			}
+			if op.IsControlFlow() && op != JUMPI {
+				continues = false
+			}
+			
+			// Compute the result if possible
+			if op.StackWrites() == 1 {
+				result := unknown()
+				if op == MLOAD {
+					if value, ok := state.Memory[args[0].Key()]; ok {
+						result = value
+					}
+				} else {
+					values := make([]*big.Int, len(args))
+					known := true
+					for i, arg := range args {
+						values[i] = arg.Value
+						known = known && arg.Value != nil
+					}
+					if known {
+						if value, ok := Evaluate(op, values...); ok {
+							result = abstractValue{Value: value}
+						}
+					}
+				}
+				state.Stack = append(state.Stack, result)
+			}
+		}
+		
+		// Continue with the next block in the code
+		if continues {
+			last := state.Block.Instructions[len(state.Block.Instructions) - 1]
+			next(last.Offset + last.Op.OperandSize() + 1, false)
+		}
+	}
+	return reached
+}
+
+func copyValues(values map[string]abstractValue) map[string]abstractValue {
+	result := make(map[string]abstractValue)
+	for key, value := range values {
+		result[key] = value
+	}
+	return result
+}
+
+func copyRegions(regions map[string]Region) map[string]Region {
+	result := make(map[string]Region)
+	for key, region := range regions {
+		result[key] = region
+	}
+	return result
+}
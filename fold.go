@@ -0,0 +1,200 @@
+package evmdis
+
+// What an instruction reads or writes besides the stack
+const (
+	memoryEffect = 1 << iota
+	storageEffect
+	transientEffect
+	stateEffect // Balances, code and return data of other accounts
+	allEffects = memoryEffect | storageEffect | transientEffect | stateEffect
+)
+
+func (op OpCode) reads() int {
+	switch op {
+	case MLOAD, SHA3:
+		return memoryEffect
+	case SLOAD:
+		return storageEffect
+	case TLOAD:
+		return transientEffect
+	case BALANCE, SELFBALANCE, EXTCODESIZE, EXTCODEHASH, RETURNDATASIZE:
+		return stateEffect
+	}
+	return 0
+}
+
+func (op OpCode) writes() int {
+	switch op {
+	case MSTORE, MSTORE8, MCOPY, CALLDATACOPY, CODECOPY, EXTCODECOPY, RETURNDATACOPY:
+		return memoryEffect
+	case SSTORE:
+		return storageEffect
+	case TSTORE:
+		return transientEffect
+	case CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE, CREATE2, SELFDESTRUCT:
+		return allEffects
+	}
+	return 0
+}
+
+// Instructions whose result depends on when exactly they execute
+func (op OpCode) isMovable() bool {
+	switch op {
+	case GAS, MSIZE:
+		return false
+	}
+	return op.writes() == 0
+}
+
+// What the expression reads, including the operations folded into it
+func expressionReads(expression Expression) int {
+	switch expression := expression.(type) {
+	case *Cast:
+		return expressionReads(expression.Value)
+	case *StorageLocation:
+		reads := 0
+		for _, key := range expression.Keys {
+			reads |= expressionReads(key)
+		}
+		return reads
+	case *Encoding:
+		reads := expressionReads(expression.Selector)
+		for _, value := range expression.Values {
+			reads |= expressionReads(value)
+		}
+		return reads
+	}
+	operation, ok := expression.(*Operation)
+	if !ok {
+		return 0
+	}
+	reads := operation.Op.reads()
+	for _, input := range operation.Inputs {
+		reads |= expressionReads(input)
+	}
+	return reads
+}
+
+func countUses(uses map[string]int, expression Expression) {
+	switch expression := expression.(type) {
+	case Variable:
+		uses[expression.Label]++
+	case *Operation:
+		for _, input := range expression.Inputs {
+			countUses(uses, input)
+		}
+	case *Cast:
+		countUses(uses, expression.Value)
+	case *StorageLocation:
+		for _, key := range expression.Keys {
+			countUses(uses, key)
+		}
+	case *Encoding:
+		countUses(uses, expression.Selector)
+		for _, value := range expression.Values {
+			countUses(uses, value)
+		}
+	}
+}
+
+// Counts where every variable is used. Values flowing into other blocks
+// are used by phi nodes or directly by statements there, only the stack
+// left by functions is used by its outputs.
+func (ssa *SSAProgram) uses() map[string]int {
+	uses := make(map[string]int)
+	for _, block := range ssa.Blocks {
+		for _, statement := range block.Statements {
+			for _, input := range statement.Inputs {
+				countUses(uses, input)
+			}
+		}
+		for _, phi := range block.Phis {
+			for _, input := range phi.Inputs {
+				countUses(uses, input)
+			}
+		}
+		if block.returnsOutputs() || ssa.isFunctionReturn(block) {
+			for _, output := range block.Outputs {
+				countUses(uses, output)
+			}
+		}
+	}
+	for _, call := range ssa.Calls {
+		for _, argument := range call.Arguments {
+			countUses(uses, argument)
+		}
+	}
+	return uses
+}
+
+// The places in an input of a statement a variable can be inlined into:
+// the input itself, the value of a cast, the keys of a storage location or
+// the values of an encoding
+func expressionSlots(slot *Expression) []*Expression {
+	switch expression := (*slot).(type) {
+	case *Cast:
+		return expressionSlots(&expression.Value)
+	case *StorageLocation:
+		slots := make([]*Expression, 0, len(expression.Keys))
+		for i := range expression.Keys {
+			slots = append(slots, expressionSlots(&expression.Keys[i])...)
+		}
+		return slots
+	case *Encoding:
+		slots := make([]*Expression, 0, len(expression.Values))
+		for i := range expression.Values {
+			slots = append(slots, expressionSlots(&expression.Values[i])...)
+		}
+		return slots
+	}
+	return []*Expression{slot}
+}
+
+// Inlines variables that are used once, later in the same block, into
+// the statement using them. Reads of memory, storage and state are not
+// moved past statements that could change what they read.
+func (ssa *SSAProgram) FoldExpressions() {
+	uses := ssa.uses()
+	for _, block := range ssa.Blocks {
+		for i := 0; i < len(block.Statements); i++ {
+			definition := block.Statements[i]
+			if definition.Output == nil || uses[definition.Output.Label] != 1 ||
+				!definition.Op.isMovable() {
+				continue
+			}
+			operation := &Operation{
+				Op:     definition.Op,
+				Inputs: definition.Inputs,
+			}
+			reads := expressionReads(operation)
+			
+			// Find the use, stop at the first conflicting write
+			var use *Statement
+			var slot *Expression
+			for j := i + 1; j < len(block.Statements) && use == nil; j++ {
+				for k := range block.Statements[j].Inputs {
+					for _, candidate := range expressionSlots(&block.Statements[j].Inputs[k]) {
+						if variable, ok := (*candidate).(Variable); ok && variable.Label == definition.Output.Label {
+							use = block.Statements[j]
+							slot = candidate
+							break
+						}
+					}
+					if use != nil {
+						break
+					}
+				}
+				if use == nil && block.Statements[j].Op.writes() & reads != 0 {
+					break
+				}
+			}
+			if use == nil {
+				continue
+			}
+			
+			*slot = operation
+			block.Statements = append(block.Statements[:i], block.Statements[i + 1:]...)
+			i--
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package evmdis
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Pushes the arguments of the instruction, top of the stack first, and
+// stores its result in slot 0
+func storeResult(op OpCode, args ...string) string {
+	code := ""
+	for i := len(args) - 1; i >= 0; i-- {
+		code += fmt.Sprintf("7f%064s", args[i])
+	}
+	return code + fmt.Sprintf("%02x", byte(op)) + "600055" + "00"
+}
+
+func TestFoldConstants(t *testing.T) {
+	tests := []struct {
+		op       OpCode
+		args     []string
+		expected string
+	}{
+		{ADD, []string{maxWord, "2"}, "1"},
+		{MUL, []string{minWord, "3"}, minWord},
+		{SUB, []string{"1", "2"}, maxWord},
+		{DIV, []string{"9", "2"}, "4"},
+		{DIV, []string{"9", "0"}, "0"},
+		{SDIV, []string{minWord, maxWord}, minWord},
+		{SDIV, []string{maxWord, "0"}, "0"},
+		{MOD, []string{"9", "4"}, "1"},
+		{MOD, []string{"9", "0"}, "0"},
+		{SMOD, []string{"fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7", "4"}, maxWord},
+		{SMOD, []string{maxWord, "0"}, "0"},
+		{ADDMOD, []string{maxWord, "1", "10"}, "0"},
+		{ADDMOD, []string{"1", "1", "0"}, "0"},
+		{MULMOD, []string{maxWord, "2", maxWord}, "0"},
+		{MULMOD, []string{"1", "1", "0"}, "0"},
+		{EXP, []string{"2", "100"}, "0"},
+		{EXP, []string{"a", "2"}, "64"},
+		{SIGNEXTEND, []string{"0", "80"}, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff80"},
+		{SIGNEXTEND, []string{"20", "80"}, "80"},
+		{LT, []string{"1", maxWord}, "1"},
+		{GT, []string{"1", maxWord}, "0"},
+		{SLT, []string{"1", maxWord}, "0"},
+		{SGT, []string{"1", maxWord}, "1"},
+		{EQ, []string{maxWord, maxWord}, "1"},
+		{ISZERO, []string{"0"}, "1"},
+		{AND, []string{"f0", "3c"}, "30"},
+		{OR, []string{"f0", "3c"}, "fc"},
+		{XOR, []string{"f0", "3c"}, "cc"},
+		{NOT, []string{"1"}, "fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"},
+		{BYTE, []string{"1f", "abcd"}, "cd"},
+		{BYTE, []string{"20", maxWord}, "0"},
+		{SHL, []string{"8", "ab"}, "ab00"},
+		{SHL, []string{"100", "1"}, "0"},
+		{SHL, []string{maxWord, "1"}, "0"},
+		{SHR, []string{"8", "ab00"}, "ab"},
+		{SHR, []string{"100", maxWord}, "0"},
+		{SAR, []string{"8", minWord}, "ff80000000000000000000000000000000000000000000000000000000000000"},
+		{SAR, []string{"100", minWord}, maxWord},
+		{SAR, []string{"100", "7f"}, "0"},
+	}
+	for _, test := range tests {
+		ssa := compileSSA(t, storeResult(test.op, test.args...))
+		ssa.ConstructSSA()
+		ssa.Simplify()
+		ssa.FoldExpressions()
+		values := storedValues(ssa)
+		if len(values) != 1 {
+			t.Fatalf("%v%v: expected 1 store, got %v", test.op, test.args, values)
+		}
+		constant, ok := values[0].(Constant)
+		if !ok || constant.Value.Cmp(word(t, test.expected)) != 0 {
+			t.Errorf("%v%v: expected 0x%v, got %v", test.op, test.args, test.expected, values[0])
+		}
+	}
+}
+
+func TestFoldExpressions(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		op       OpCode // The instruction that may be folded
+		folded   bool
+	}{
+		// s[0] = msg.data[0] + 1
+		{"single use", "6001600035" + "01600055" + "00", CALLDATALOAD, true},
+		// x = msg.data[0]; s[0] = x; s[1] = x;
+		{"two uses", "600035" + "80600055600155" + "00", CALLDATALOAD, false},
+		// x = s[0]; s[0] = 1; s[1] = x;
+		{"storage written", "600054" + "6001600055" + "600155" + "00", SLOAD, false},
+		// x = s[0]; m[0] = 1; s[1] = x;
+		{"memory written", "600054" + "6001600052" + "600155" + "00", SLOAD, true},
+		// x = m[0]; s[0] = 1; s[1] = x;
+		{"storage written after memory read", "600051" + "6001600055" + "600155" + "00", MLOAD, true},
+		// x = m[0]; m[0] = 1; s[1] = x;
+		{"memory written after memory read", "600051" + "6001600052" + "600155" + "00", MLOAD, false},
+		// s[0] = gasleft(), the gas left depends on where it is read
+		{"gas", "5a" + "600055" + "00", GAS, false},
+	}
+	for _, test := range tests {
+		ssa := compileSSA(t, test.code)
+		ssa.ConstructSSA()
+		ssa.Simplify()
+		ssa.FoldExpressions()
+		statement := false
+		for _, block := range ssa.Blocks {
+			for _, other := range block.Statements {
+				statement = statement || other.Op == test.op
+			}
+		}
+		if statement == test.folded {
+			t.Errorf("%v: expected %v to be folded %v, got %v", test.name, test.op, test.folded, storedValues(ssa))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package evmdis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fork selects the instruction set of a particular Ethereum hard fork.
+// Later forks are a superset of earlier ones.
+type Fork int
+
+const (
+	Frontier Fork = iota
+	Homestead
+	Byzantium
+	Constantinople
+	Istanbul
+	London
+	Paris          // DIFFICULTY returns the randomness of the beacon chain
+	Shanghai
+	Cancun
+)
+
+// The instruction set used when none is specified
+const LatestFork = Cancun
+
+var forkToString = map[Fork]string{
+	Frontier:       "frontier",
+	Homestead:      "homestead",
+	Byzantium:      "byzantium",
+	Constantinople: "constantinople",
+	Istanbul:       "istanbul",
+	London:         "london",
+	Paris:          "paris",
+	Shanghai:       "shanghai",
+	Cancun:         "cancun",
+}
+
+func (fork Fork) String() string {
+	str := forkToString[fork]
+	if len(str) == 0 {
+		return fmt.Sprintf("Missing fork %d", int(fork))
+	}
+	return str
+}
+
+func ForkByName(name string) (Fork, error) {
+	name = strings.ToLower(name)
+	for fork, str := range forkToString {
+		if str == name {
+			return fork, nil
+		}
+	}
+	return LatestFork, fmt.Errorf("Unknown fork: %v", name)
+}
+
+// The fork that introduced each opcode. Opcodes not listed here are part
+// of the original Frontier instruction set.
+var opCodeToFork = map[OpCode]Fork{
+	DELEGATECALL:   Homestead,
+	
+	REVERT:         Byzantium,
+	RETURNDATASIZE: Byzantium,
+	RETURNDATACOPY: Byzantium,
+	STATICCALL:     Byzantium,
+	
+	SHL:            Constantinople,
+	SHR:            Constantinople,
+	SAR:            Constantinople,
+	CREATE2:        Constantinople,
+	EXTCODEHASH:    Constantinople,
+	
+	CHAINID:        Istanbul,
+	SELFBALANCE:    Istanbul,
+	
+	BASEFEE:        London,
+	
+	PUSH0:          Shanghai,
+	
+	TLOAD:          Cancun,
+	TSTORE:         Cancun,
+	MCOPY:          Cancun,
+	BLOBHASH:       Cancun,
+	BLOBBASEFEE:    Cancun,
+}
+
+// Returns true if the opcode exists in the instruction set of the fork.
+func (op OpCode) IsDefined(fork Fork) bool {
+	if _, ok := opCodeToString[op]; !ok {
+		return false
+	}
+	return opCodeToFork[op] <= fork
+}
@@ -0,0 +1,65 @@
+package evmdis
+
+import (
+	"testing"
+)
+
+func TestIsDefined(t *testing.T) {
+	tests := []struct {
+		op       OpCode
+		fork     Fork // The first fork defining the opcode
+	}{
+		{STOP, Frontier},
+		{SHA3, Frontier},
+		{DIFFICULTY, Frontier},
+		{SELFDESTRUCT, Frontier},
+		{DELEGATECALL, Homestead},
+		{REVERT, Byzantium},
+		{RETURNDATASIZE, Byzantium},
+		{RETURNDATACOPY, Byzantium},
+		{STATICCALL, Byzantium},
+		{SHL, Constantinople},
+		{SHR, Constantinople},
+		{SAR, Constantinople},
+		{CREATE2, Constantinople},
+		{EXTCODEHASH, Constantinople},
+		{CHAINID, Istanbul},
+		{SELFBALANCE, Istanbul},
+		{BASEFEE, London},
+		{PUSH0, Shanghai},
+		{TLOAD, Cancun},
+		{TSTORE, Cancun},
+		{MCOPY, Cancun},
+		{BLOBHASH, Cancun},
+		{BLOBBASEFEE, Cancun},
+	}
+	for _, test := range tests {
+		for fork := Frontier; fork <= LatestFork; fork++ {
+			if defined := test.op.IsDefined(fork); defined != (fork >= test.fork) {
+				t.Errorf("%v: expected defined %v at %v, got %v", test.op, fork >= test.fork, fork, defined)
+			}
+		}
+	}
+}
+
+func TestIsDefinedUnassigned(t *testing.T) {
+	for _, op := range []OpCode{0x0c, 0x21, 0x4b, 0xa5, 0xef} {
+		if op.IsDefined(LatestFork) {
+			t.Errorf("expected 0x%02x to be undefined", byte(op))
+		}
+	}
+}
+
+func TestForkByName(t *testing.T) {
+	for fork := Frontier; fork <= LatestFork; fork++ {
+		if named, err := ForkByName(fork.String()); err != nil || named != fork {
+			t.Errorf("expected %v, got %v (%v)", fork, named, err)
+		}
+	}
+	if _, err := ForkByName("Paris"); err != nil {
+		t.Errorf("expected names to be case insensitive, got %v", err)
+	}
+	if fork, err := ForkByName("metropolis"); err == nil || fork != LatestFork {
+		t.Errorf("expected an error and the latest fork, got %v (%v)", fork, err)
+	}
+}
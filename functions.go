@@ -0,0 +1,300 @@
+package evmdis
+
+import (
+	"fmt"
+	"sort"
+)
+
+// An internal (private) function. Solidity calls these by pushing the
+// return address and the arguments, then jumping to the entry block. The
+// function returns by jumping to the return address left on the stack
+// below its results.
+type InternalFunction struct {
+	Label           string
+	Entry           *StatementBlock
+	Blocks          []*StatementBlock
+	Returns         []*StatementBlock // Blocks that jump back to the caller
+	Arguments       int
+	Results         int
+}
+
+// A jump to an internal function
+type CallSite struct {
+	Block           *StatementBlock
+	Function        *InternalFunction
+	Continuation    *StatementBlock // The return address
+	Arguments       []Expression
+}
+
+// Recovers internal functions from jumps that push a return address. Must
+// run after ResolveJumps, the return jumps are computed jumps.
+func (ssa *SSAProgram) RecoverFunctions() {
+	ssa.Functions = make([]*InternalFunction, 0)
+	ssa.Calls = make(map[*StatementBlock]*CallSite)
+	
+	// A call jumps to a fixed entry and leaves a return address on the
+	// stack. The arguments are pushed after the return address.
+	continuations := ssa.continuations()
+	entries := make(map[*StatementBlock]*InternalFunction)
+	for _, block := range ssa.Blocks {
+		i := ssa.returnAddress(block, continuations)
+		if i < 0 {
+			continue
+		}
+		function := entries[block.NextBlock]
+		if function == nil {
+			function = &InternalFunction{
+				Label:     fmt.Sprintf("internal_%x", block.NextBlock.Offset),
+				Entry:     block.NextBlock,
+				Arguments: len(block.Outputs) - 1 - i,
+				Results:   -1,
+			}
+			entries[block.NextBlock] = function
+			ssa.Functions = append(ssa.Functions, function)
+		}
+		constant := block.Outputs[i].(Constant)
+		ssa.Calls[block] = &CallSite{
+			Block:        block,
+			Function:     function,
+			Continuation: continuations[int(constant.Value.Int64())],
+			Arguments:    block.Outputs[i + 1:],
+		}
+	}
+	sort.Slice(ssa.Functions, func(i, j int) bool {
+		return ssa.Functions[i].Entry.Offset < ssa.Functions[j].Entry.Offset
+	})
+	
+	// Collect the bodies and count the results
+	for _, function := range ssa.Functions {
+		ssa.recoverBody(function, make(map[*InternalFunction]bool))
+	}
+	for _, function := range ssa.Functions {
+		function.Entry.Label = function.Label
+	}
+	
+	// The continuation of a call sees the caller's stack below the
+	// results. Connect those inputs to the caller's outputs.
+	for _, call := range ssa.Calls {
+		continuation := call.Continuation
+		if ssa.callsReturningTo(continuation) != 1 || call.Function.Results < 0 {
+			continue
+		}
+		base := call.Block.Outputs[:len(call.Block.Outputs) - len(call.Arguments) - 1]
+		inputs := len(continuation.Inputs) - call.Function.Results
+		for i := 0; i < inputs && i < len(base); i++ {
+			continuation.Replace(continuation.Inputs[inputs - 1 - i],
+				base[len(base) - 1 - i])
+		}
+	}
+	
+	// Mark the call and return edges
+	ssa.ComputeIncoming()
+}
+
+// Return addresses are targets of computed jumps
+func (ssa *SSAProgram) continuations() map[int]*StatementBlock {
+	continuations := make(map[int]*StatementBlock)
+	for _, block := range ssa.Blocks {
+		if !block.isReturn() {
+			continue
+		}
+		for _, target := range block.Statements[len(block.Statements) - 1].Targets {
+			if continuation := ssa.BlockByOffset(target); continuation != nil {
+				continuations[target] = continuation
+			}
+		}
+	}
+	return continuations
+}
+
+// The index in the outputs of the return address left by a call, or -1 if
+// the block does not end in a call
+func (ssa *SSAProgram) returnAddress(block *StatementBlock, continuations map[int]*StatementBlock) int {
+	n := len(block.Statements)
+	if n == 0 || block.Statements[n - 1].Op != JUMP ||
+		block.NextBlock == nil || block.NextBlock == ssa.ErrorBlock {
+		return -1
+	}
+	if _, ok := block.Statements[n - 1].Inputs[0].(Constant); !ok {
+		return -1
+	}
+	for i := len(block.Outputs) - 1; i >= 0; i-- {
+		constant, ok := block.Outputs[i].(Constant)
+		if !ok || !constant.Value.IsInt64() {
+			continue
+		}
+		continuation := continuations[int(constant.Value.Int64())]
+		if continuation != nil && continuation != block.NextBlock {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns true if the block ends in a computed jump with known targets
+func (block *StatementBlock) isReturn() bool {
+	n := len(block.Statements)
+	if n == 0 || block.Statements[n - 1].Op != JUMP {
+		return false
+	}
+	last := block.Statements[n - 1]
+	_, constant := last.Inputs[0].(Constant)
+	return !constant && len(last.Targets) > 0
+}
+
+func (ssa *SSAProgram) isFunctionReturn(block *StatementBlock) bool {
+	for _, function := range ssa.Functions {
+		for _, other := range function.Returns {
+			if other == block {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (ssa *SSAProgram) callsReturningTo(continuation *StatementBlock) int {
+	count := 0
+	for _, call := range ssa.Calls {
+		if call.Continuation == continuation {
+			count++
+		}
+	}
+	return count
+}
+
+// Finds the blocks of the function by following the control flow from
+// the entry, stepping over nested calls and stopping at returns. The
+// stack height relative to the entry gives the number of results.
+func (ssa *SSAProgram) recoverBody(function *InternalFunction, active map[*InternalFunction]bool) {
+	if function.Results >= 0 || active[function] {
+		return
+	}
+	active[function] = true
+	defer delete(active, function)
+	
+	function.Blocks = make([]*StatementBlock, 0)
+	function.Returns = make([]*StatementBlock, 0)
+	heights := map[*StatementBlock]int{function.Entry: 0}
+	work := []*StatementBlock{function.Entry}
+	for len(work) > 0 {
+		block := work[0]
+		work = work[1:]
+		function.Blocks = append(function.Blocks, block)
+		height := heights[block] + len(block.Outputs) - len(block.Inputs)
+		
+		// The return address is below the arguments
+		if block.isReturn() {
+			function.Returns = append(function.Returns, block)
+			if function.Results < 0 {
+				function.Results = height + function.Arguments + 1
+			}
+			continue
+		}
+		
+		successors := make([]*StatementBlock, 0)
+		if call, ok := ssa.Calls[block]; ok {
+			ssa.recoverBody(call.Function, active)
+			if call.Function.Results < 0 {
+				continue
+			}
+			height += call.Function.Results - call.Function.Arguments - 1
+			successors = append(successors, call.Continuation)
+		} else {
+			if block.NextBlock != nil {
+				successors = append(successors, block.NextBlock)
+			}
+			successors = append(successors, block.CondBlocks...)
+			successors = append(successors, block.JumpTargets...)
+		}
+		for _, successor := range successors {
+			if _, ok := heights[successor]; ok || successor == nil || successor == ssa.ErrorBlock {
+				continue
+			}
+			heights[successor] = height
+			work = append(work, successor)
+		}
+	}
+	sort.Slice(function.Blocks, func(i, j int) bool {
+		return function.Blocks[i].Offset < function.Blocks[j].Offset
+	})
+}
+
+// Returns the internal function starting at the block, if any
+func (ssa *SSAProgram) FunctionAt(block *StatementBlock) *InternalFunction {
+	for _, function := range ssa.Functions {
+		if function.Entry == block {
+			return function
+		}
+	}
+	return nil
+}
+
+func (function *InternalFunction) String() string {
+	return fmt.Sprintf("%v: %v arguments → %v results, %v blocks",
+		function.Label, function.Arguments, function.Results, len(function.Blocks))
+}
+
+// The values left on the stack for the caller, in declaration order
+func (function *InternalFunction) returnStatement(block *StatementBlock) string {
+	results := function.Results
+	if results > len(block.Outputs) {
+		results = len(block.Outputs)
+	}
+	if results <= 0 {
+		return "return;"
+	}
+	str := "return "
+	if results > 1 {
+		str += "("
+	}
+	for i, output := range block.Outputs[len(block.Outputs) - results:] {
+		if i > 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("%v", output)
+	}
+	if results > 1 {
+		str += ")"
+	}
+	return str + ";"
+}
+
+// The continuation inputs receiving the results of the call
+func (call *CallSite) Results() []Expression {
+	inputs := call.Continuation.Inputs
+	n := call.Function.Results
+	if n > len(inputs) {
+		n = len(inputs)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return inputs[len(inputs) - n:]
+}
+
+func (call *CallSite) String() string {
+	str := ""
+	results := call.Results()
+	switch {
+	case len(results) == 1:
+		str += fmt.Sprintf("uint %v = ", results[0])
+	case len(results) > 1:
+		str += "("
+		for i, result := range results {
+			if i > 0 {
+				str += ", "
+			}
+			str += fmt.Sprintf("uint %v", result)
+		}
+		str += ") = "
+	}
+	str += fmt.Sprintf("%v(", call.Function.Label)
+	for i, argument := range call.Arguments {
+		if i > 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("%v", argument)
+	}
+	return str + ");"
+}
@@ -0,0 +1,43 @@
+package evmdis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRecoverFunctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		calls    []string
+	}{
+		// s[0] = f(5); with f(a) = a + a
+		{"one caller", "60076005600c565b600055005b80019056", []string{"internal_c(0x5)"}},
+		// s[0] = f(5); s[1] = f(6);
+		{"several callers", "600760056017565b600055601260066017565b600155005b80019056",
+			[]string{"internal_17(0x5)", "internal_17(0x6)"}},
+	}
+	for _, test := range tests {
+		ssa := recoverContract(t, test.code)
+		if len(ssa.Functions) != 1 {
+			t.Fatalf("%v: expected one function, got %v", test.name, ssa.Functions)
+		}
+		function := ssa.Functions[0]
+		if str := fmt.Sprintf("%v", function); !strings.HasSuffix(str, "1 arguments → 1 results, 1 blocks") {
+			t.Errorf("%v: expected a function of one argument and result, got %v", test.name, str)
+		}
+		if len(ssa.Calls) != len(test.calls) {
+			t.Errorf("%v: expected %v calls, got %v", test.name, len(test.calls), len(ssa.Calls))
+		}
+		contract := ssa.Contract()
+		for _, call := range test.calls {
+			if !strings.Contains(contract, call) {
+				t.Errorf("%v: expected %v in\n%v", test.name, call, contract)
+			}
+		}
+		if !strings.Contains(contract, "private returns (uint) {") {
+			t.Errorf("%v: expected the function to return its result in\n%v", test.name, contract)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package evmdis
+
+// The set of valid jump destinations. A jump is only valid if it lands on
+// a JUMPDEST opcode, not on a 0x5B byte that is part of push data.
+type JumpDestAnalysis struct {
+	Valid           []byte // Bitmap with one bit per byte of code
+	Hidden          []int  // Offsets of JUMPDEST bytes inside push data
+}
+
+// Computes the valid jump destinations the same way the EVM does: a
+// linear scan over the complete code, skipping push data.
+func NewJumpDestAnalysis(bytecode []byte) *JumpDestAnalysis {
+	analysis := &JumpDestAnalysis{
+		Valid:  make([]byte, (len(bytecode) + 7) / 8),
+		Hidden: make([]int, 0),
+	}
+	for i := 0; i < len(bytecode); i++ {
+		op := OpCode(bytecode[i])
+		if op == JUMPDEST {
+			analysis.Valid[i / 8] |= 1 << uint(i % 8)
+			continue
+		}
+		for j := 1; j <= op.OperandSize() && i + j < len(bytecode); j++ {
+			if OpCode(bytecode[i + j]) == JUMPDEST {
+				analysis.Hidden = append(analysis.Hidden, i + j)
+			}
+		}
+		i += op.OperandSize()
+	}
+	return analysis
+}
+
+func (analysis *JumpDestAnalysis) IsValid(offset int) bool {
+	if offset < 0 || offset / 8 >= len(analysis.Valid) {
+		return false
+	}
+	return analysis.Valid[offset / 8] & (1 << uint(offset % 8)) != 0
+}
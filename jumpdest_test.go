@@ -0,0 +1,32 @@
+package evmdis
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func hiddenJumpDests(program *Program) []int {
+	offsets := make([]int, 0)
+	for _, diagnostic := range program.Diagnostics {
+		if diagnostic.Kind == HiddenJumpDest {
+			offsets = append(offsets, diagnostic.Offset)
+		}
+	}
+	return offsets
+}
+
+func TestHiddenJumpDestOnlyInCode(t *testing.T) {
+	// The constructor copies the 12 byte runtime image at 0xC, which
+	// pushes a 0x5B byte
+	bytecode, _ := hex.DecodeString("600c600c600039600c6000f3" + "605b00000000000000000000")
+	creation, runtime, err := SplitCreation(bytecode, LatestFork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hidden := hiddenJumpDests(creation); len(hidden) != 0 {
+		t.Errorf("creation: expected no hidden JUMPDEST in the runtime image, got %v", hidden)
+	}
+	if hidden := hiddenJumpDests(runtime); len(hidden) != 1 || hidden[0] != 1 {
+		t.Errorf("runtime: expected a hidden JUMPDEST at 0x1, got %v", hidden)
+	}
+}
@@ -0,0 +1,91 @@
+package evmdis
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Keccak-256 as used by the EVM. This is the original Keccak padding, not
+// the one of the SHA-3 standard in crypto/sha3.
+
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808A, 0x8000000080008000,
+	0x000000000000808B, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008A, 0x0000000000000088, 0x0000000080008009, 0x000000008000000A,
+	0x000000008000808B, 0x800000000000008B, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800A, 0x800000008000000A,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var keccakRotations = [25]int{
+	0, 1, 62, 28, 27,
+	36, 44, 6, 55, 20,
+	3, 10, 43, 25, 39,
+	41, 45, 15, 21, 8,
+	18, 2, 61, 56, 14,
+}
+
+// The Keccak-f[1600] permutation, lane (x, y) is a[x + 5 * y]
+func keccakF(a *[25]uint64) {
+	for round := 0; round < 24; round++ {
+		// θ
+		var c [5]uint64
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x + 5] ^ a[x + 10] ^ a[x + 15] ^ a[x + 20]
+		}
+		for x := 0; x < 5; x++ {
+			d := c[(x + 4) % 5] ^ bits.RotateLeft64(c[(x + 1) % 5], 1)
+			for y := 0; y < 25; y += 5 {
+				a[x + y] ^= d
+			}
+		}
+		
+		// ρ and π
+		var b [25]uint64
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				b[y + 5 * ((2 * x + 3 * y) % 5)] = bits.RotateLeft64(a[x + 5 * y], keccakRotations[x + 5 * y])
+			}
+		}
+		
+		// χ
+		for y := 0; y < 25; y += 5 {
+			for x := 0; x < 5; x++ {
+				a[x + y] = b[x + y] ^ (^b[(x + 1) % 5 + y] & b[(x + 2) % 5 + y])
+			}
+		}
+		
+		// ι
+		a[0] ^= keccakRoundConstants[round]
+	}
+}
+
+func Keccak256(data []byte) [32]byte {
+	const rate = 136
+	var state [25]uint64
+	
+	// Pad with 0x01 … 0x80 to a multiple of the rate
+	padded := make([]byte, len(data) + rate - len(data) % rate)
+	copy(padded, data)
+	padded[len(data)] ^= 0x01
+	padded[len(padded) - 1] ^= 0x80
+	
+	for offset := 0; offset < len(padded); offset += rate {
+		for i := 0; i < rate / 8; i++ {
+			state[i] ^= binary.LittleEndian.Uint64(padded[offset + 8 * i:])
+		}
+		keccakF(&state)
+	}
+	
+	var hash [32]byte
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint64(hash[8 * i:], state[i])
+	}
+	return hash
+}
+
+// The function selector of a signature like "transfer(address,uint256)"
+func Selector(signature string) uint32 {
+	hash := Keccak256([]byte(signature))
+	return binary.BigEndian.Uint32(hash[:4])
+}
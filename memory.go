@@ -0,0 +1,533 @@
+package evmdis
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// A word of memory at a constant offset from a base value
+type memoryAddress struct {
+	Base            string // Empty for constant addresses
+	Offset          int64
+}
+
+// The words of a buffer built in memory, as the ABI encodes them. Calls
+// start with the selector of the called function.
+type Encoding struct {
+	Expression
+	Selector        Expression // Nil without a selector
+	Values          []Expression
+}
+
+func (encoding *Encoding) String() string {
+	str := "abi.encode("
+	if encoding.Selector != nil {
+		str = fmt.Sprintf("abi.encodeWithSelector(%v", encoding.Selector)
+		if len(encoding.Values) > 0 {
+			str += ", "
+		}
+	}
+	for i, value := range encoding.Values {
+		if i > 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("%v", value)
+	}
+	return str + ")"
+}
+
+// Follows values stored to memory at addresses known relative to each
+// other
+type memoryAnalysis struct {
+	ssa             *SSAProgram
+	definitions     map[string]*Statement
+	dominators      *DominatorTree
+	blocks          map[*Statement]*StatementBlock
+}
+
+func (ssa *SSAProgram) memoryAnalysis() *memoryAnalysis {
+	m := &memoryAnalysis{
+		ssa:         ssa,
+		definitions: ssa.definitions(),
+		dominators:  ssa.Dominators(),
+		blocks:      make(map[*Statement]*StatementBlock),
+	}
+	for _, block := range ssa.Blocks {
+		for _, statement := range block.Statements {
+			m.blocks[statement] = block
+		}
+	}
+	return m
+}
+
+// The block of the statement and its index there
+func (m *memoryAnalysis) position(statement *Statement) (*StatementBlock, int) {
+	block := m.blocks[statement]
+	if block != nil {
+		for i, other := range block.Statements {
+			if other == statement {
+				return block, i
+			}
+		}
+	}
+	return nil, 0
+}
+
+// Removes the statements from their blocks. Returns the number removed.
+func (m *memoryAnalysis) remove(removed map[*Statement]bool) int {
+	count := 0
+	for _, block := range m.ssa.Blocks {
+		statements := make([]*Statement, 0, len(block.Statements))
+		for _, statement := range block.Statements {
+			if removed[statement] {
+				delete(m.blocks, statement)
+				count++
+				continue
+			}
+			statements = append(statements, statement)
+		}
+		block.Statements = statements
+	}
+	return count
+}
+
+// The statement defining a variable, nil for other expressions
+func (m *memoryAnalysis) definition(expression Expression) *Statement {
+	if label, ok := variableLabel(expression); ok {
+		return m.definitions[label]
+	}
+	return nil
+}
+
+func (m *memoryAnalysis) address(expression Expression) (memoryAddress, bool) {
+	if constant, ok := expression.(Constant); ok {
+		return memoryAddress{Offset: constant.Value.Int64()}, constant.Value.IsInt64()
+	}
+	op, inputs := STOP, []Expression(nil)
+	statement := m.definition(expression)
+	if operation, ok := expression.(*Operation); ok {
+		op, inputs = operation.Op, operation.Inputs
+	} else if statement != nil {
+		op, inputs = statement.Op, statement.Inputs
+	}
+	switch op {
+	case MLOAD:
+		if isConstant(inputs[0], 0x40) {
+			return m.freePointer(statement), true
+		}
+	case ADD:
+		for i := 0; i < 2; i++ {
+			constant, ok := inputs[i].(Constant)
+			if !ok || !constant.Value.IsInt64() {
+				continue
+			}
+			if address, ok := m.address(inputs[1 - i]); ok {
+				address.Offset += constant.Value.Int64()
+				return address, true
+			}
+		}
+	}
+	return memoryAddress{Base: expressionKey(expression)}, true
+}
+
+// The address the free memory pointer at 0x40 holds when the statement
+// reads it: what the latest allocation in the code dominating it stored.
+// Without an allocation, or for reads folded into other statements, it is
+// the base of all free memory. Allocations on branches that do not
+// dominate the read are not seen.
+func (m *memoryAnalysis) freePointer(read *Statement) memoryAddress {
+	block, index := m.position(read)
+	if block == nil {
+		return memoryAddress{Base: "0x40"}
+	}
+	statements := block.Statements[:index]
+	for {
+		for i := len(statements) - 1; i >= 0; i-- {
+			statement := statements[i]
+			if statement.Op == MSTORE && isConstant(statement.Inputs[0], 0x40) {
+				address, _ := m.address(statement.Inputs[1])
+				return address
+			}
+		}
+		idom, ok := m.dominators.Idom[block].(*StatementBlock)
+		if !ok {
+			return memoryAddress{Base: "0x40"}
+		}
+		block, statements = idom, idom.Statements
+	}
+}
+
+// The distance between two addresses, false if they have different bases
+func (m *memoryAnalysis) distance(from Expression, to Expression) (int64, bool) {
+	a, ok := m.address(from)
+	if !ok {
+		return 0, false
+	}
+	b, ok := m.address(to)
+	if !ok || a.Base != b.Base {
+		return 0, false
+	}
+	return b.Offset - a.Offset, true
+}
+
+// The length of data in memory if it is constant: a constant, the
+// distance from its start to its end, or a constant word stored in memory
+func (m *memoryAnalysis) length(expression Expression) (int64, bool) {
+	if constant, ok := expression.(Constant); ok {
+		return constant.Value.Int64(), constant.Value.IsInt64()
+	}
+	statement := m.definition(expression)
+	if statement == nil {
+		return 0, false
+	}
+	switch statement.Op {
+	case SUB:
+		return m.distance(statement.Inputs[1], statement.Inputs[0])
+	case MLOAD:
+		block, i := m.position(statement)
+		address, ok := m.address(statement.Inputs[0])
+		if block == nil || !ok {
+			return 0, false
+		}
+		if word, ok := m.words(block, i, address)[0]; ok {
+			if constant, ok := word.Value.(Constant); ok && constant.Value.IsInt64() {
+				return constant.Value.Int64(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// A word stored to memory before a statement
+type memoryWord struct {
+	Value           Expression
+	Store           *Statement
+	Local           bool // Stored in the same block and not read in between
+}
+
+// Returns true if the statement may read stored data. The free memory
+// pointer is assumed to be only used as such.
+func readsMemory(statement *Statement) bool {
+	switch statement.Op {
+	case MLOAD:
+		return !isConstant(statement.Inputs[0], 0x40)
+	case SHA3, LOG0, LOG1, LOG2, LOG3, LOG4:
+		return true
+	}
+	return statement.Op.writes() == allEffects
+}
+
+// The words stored relative to the start address by the statements before
+// the one at the index and in the blocks that dominate it. Later stores
+// overwrite earlier ones.
+func (m *memoryAnalysis) words(block *StatementBlock, index int, start memoryAddress) map[int64]*memoryWord {
+	words := make(map[int64]*memoryWord)
+	read := false
+	node, statements := block, block.Statements[:index]
+	for {
+		for i := len(statements) - 1; i >= 0; i-- {
+			statement := statements[i]
+			read = read || readsMemory(statement)
+			if statement.Op != MSTORE {
+				continue
+			}
+			address, ok := m.address(statement.Inputs[0])
+			if !ok || address.Base != start.Base {
+				continue
+			}
+			offset := address.Offset - start.Offset
+			if _, ok := words[offset]; !ok {
+				words[offset] = &memoryWord{
+					Value: statement.Inputs[1],
+					Store: statement,
+					Local: node == block && !read,
+				}
+			}
+		}
+		idom, ok := m.dominators.Idom[node].(*StatementBlock)
+		if !ok {
+			return words
+		}
+		node, statements = idom, idom.Statements
+	}
+}
+
+// Returns true if two ranges of memory may overlap, a negative length if
+// unknown. Free memory never overlaps the scratch space at constant
+// addresses, other bases may overlap anything.
+func overlaps(a memoryAddress, aLength int64, b memoryAddress, bLength int64) bool {
+	if a.Base != b.Base {
+		return a.Base != "" && a.Base != "0x40" || b.Base != "" && b.Base != "0x40"
+	}
+	return aLength < 0 || bLength < 0 || a.Offset < b.Offset + bLength && b.Offset < a.Offset + aLength
+}
+
+// How a statement accesses memory
+const (
+	noAccess = iota
+	readAccess
+	writeAccess
+)
+
+// How the statement accesses the range of memory, and the range written.
+// Statements in the removed set only write the output of calls.
+func (m *memoryAnalysis) access(statement *Statement, start memoryAddress, length int64,
+	removed map[*Statement]bool) (int, memoryAddress, int64) {
+	if _, ok := emittedEvent(statement.Op, statement.Inputs); ok {
+		return noAccess, start, 0
+	}
+	input := bufferInput(statement.Op)
+	switch {
+	case removed[statement]:
+		if input < 1 || len(statement.Inputs) != input + 4 {
+			return noAccess, start, 0
+		}
+		output, ok := m.address(statement.Inputs[input + 2])
+		size, constant := m.length(statement.Inputs[input + 3])
+		if ok && constant && output.Base == start.Base {
+			return writeAccess, output, size
+		}
+		return noAccess, start, 0
+	case statement.Op == MSTORE:
+		if address, ok := m.address(statement.Inputs[0]); ok && address.Base == start.Base {
+			return writeAccess, address, 32
+		}
+		return noAccess, start, 0
+	case statement.Op == MLOAD:
+		if isConstant(statement.Inputs[0], 0x40) {
+			return noAccess, start, 0
+		}
+		if address, ok := m.address(statement.Inputs[0]); ok && !overlaps(address, 32, start, length) {
+			return noAccess, start, 0
+		}
+		return readAccess, start, 0
+	case statement.Op == RETURN && len(statement.Inputs) != 2:
+		return noAccess, start, 0
+	case statement.Op == SHA3, statement.Op == RETURN, statement.Op == REVERT, statement.Op >= LOG0 && statement.Op <= LOG4:
+		input = 0
+	case input < 0:
+		if readsMemory(statement) {
+			return readAccess, start, 0
+		}
+		return noAccess, start, 0
+	}
+	address, ok := m.address(statement.Inputs[input])
+	size, constant := m.length(statement.Inputs[input + 1])
+	if !constant {
+		size = -1
+	}
+	if ok && !overlaps(address, size, start, length) {
+		return noAccess, start, 0
+	}
+	return readAccess, start, 0
+}
+
+// Returns true if only the removed statements read the word stored by the
+// statement at the index, on every path from it until it is overwritten.
+// Writes over the start or end of the word leave the rest of it.
+func (m *memoryAnalysis) onlyReadBy(block *StatementBlock, index int, removed map[*Statement]bool) bool {
+	word, ok := m.address(block.Statements[index].Inputs[0])
+	if !ok {
+		return false
+	}
+	type path struct {
+		block           *StatementBlock
+		index           int
+		start, end      int64 // The bytes of the word not yet overwritten
+	}
+	
+	// Blocks are visited again for other bytes of the word
+	visited := make(map[path]bool)
+	work := []path{{block, index + 1, word.Offset, word.Offset + 32}}
+	visit := func(successor *StatementBlock, start int64, end int64) {
+		next := path{successor, 0, start, end}
+		if successor != nil && !visited[next] {
+			visited[next] = true
+			work = append(work, next)
+		}
+	}
+	for len(work) > 0 {
+		p := work[len(work) - 1]
+		work = work[:len(work) - 1]
+		
+		// Conditional jumps before the index are not taken on the path
+		condition := 0
+		for _, statement := range p.block.Statements[:p.index] {
+			if statement.Op == JUMPI {
+				condition++
+			}
+		}
+		done := false
+		for _, statement := range p.block.Statements[p.index:] {
+			start := memoryAddress{Base: word.Base, Offset: p.start}
+			switch kind, written, size := m.access(statement, start, p.end - p.start, removed); kind {
+			case readAccess:
+				return false
+			case writeAccess:
+				end := written.Offset + size
+				switch {
+				case written.Offset <= p.start && p.end <= end:
+					done = true
+				case written.Offset <= p.start && p.start < end:
+					p.start = end
+				case written.Offset < p.end && p.end <= end:
+					p.end = written.Offset
+				}
+			}
+			switch statement.Op {
+			case STOP, RETURN, REVERT, INVALID, SELFDESTRUCT:
+				done = true
+			case JUMPI:
+				// The jump leaves with the bytes not overwritten before it
+				if condition < len(p.block.CondBlocks) {
+					visit(p.block.CondBlocks[condition], p.start, p.end)
+				}
+				condition++
+			}
+			if done {
+				break
+			}
+		}
+		if done {
+			continue
+		}
+		visit(p.block.NextBlock, p.start, p.end)
+		for _, successor := range p.block.JumpTargets {
+			visit(successor, p.start, p.end)
+		}
+	}
+	return true
+}
+
+// Where the buffer a statement reads from memory is in its inputs, -1 for
+// statements that do not read buffers. The length follows the offset.
+func bufferInput(op OpCode) int {
+	switch op {
+	case SHA3:
+		return 0
+	case CALL, CALLCODE:
+		return 3
+	case DELEGATECALL, STATICCALL:
+		return 2
+	}
+	return -1
+}
+
+// The words of the buffer read by the statement at the index. The buffer
+// must have a constant length of whole words, after a selector for calls.
+// Returns false if a word is missing.
+func (m *memoryAnalysis) buffer(block *StatementBlock, index int) (*Encoding, []*Statement, bool) {
+	statement := block.Statements[index]
+	input := bufferInput(statement.Op)
+	start, ok := m.address(statement.Inputs[input])
+	if !ok {
+		return nil, nil, false
+	}
+	size, ok := m.length(statement.Inputs[input + 1])
+	if !ok || size < 0 {
+		return nil, nil, false
+	}
+	words := m.words(block, index, start)
+	encoding := &Encoding{Values: make([]Expression, 0)}
+	stores := make([]*Statement, 0)
+	offset := int64(0)
+	if statement.Op != SHA3 && size % 32 == 4 {
+		word, ok := words[0]
+		if !ok {
+			return nil, nil, false
+		}
+		selector, ok := word.Value.(Constant)
+		if !ok || selector.Value.TrailingZeroBits() < 224 {
+			return nil, nil, false
+		}
+		encoding.Selector = Constant{Value: new(big.Int).Rsh(selector.Value, 224)}
+		if word.Local {
+			stores = append(stores, word.Store)
+		}
+		offset = 4
+	}
+	if (size - offset) % 32 != 0 {
+		return nil, nil, false
+	}
+	for ; offset < size; offset += 32 {
+		word, ok := words[offset]
+		if !ok {
+			return nil, nil, false
+		}
+		encoding.Values = append(encoding.Values, word.Value)
+		if word.Local {
+			stores = append(stores, word.Store)
+		}
+	}
+	return encoding, stores, true
+}
+
+// Returns true if the free memory pointer stored by the statement at the
+// index is not read again before the code stops
+func allocationUnused(block *StatementBlock, index int) bool {
+	for _, statement := range block.Statements[index + 1:] {
+		switch {
+		case statement.Op == MLOAD && isConstant(statement.Inputs[0], 0x40):
+			return false
+		case statement.Op == STOP, statement.Op == RETURN, statement.Op == REVERT:
+			return true
+		case statement.Op.IsControlFlow():
+			return false
+		}
+	}
+	return false
+}
+
+// Recovers the buffers built in memory for hashes and calls, and rewrites
+// the statements to read the words of them instead of an offset and a
+// length. The stores building the buffers are removed if nothing else
+// reads them, as are allocations of memory not used before the code stops.
+// Buffers for returned data and events are recovered by DecodeReturns and
+// RecoverEvents, so it runs after them.
+func (ssa *SSAProgram) RecoverMemory() {
+	m := ssa.memoryAnalysis()
+	encodings := make(map[*Statement]*Encoding)
+	stores := make(map[*Statement]bool)
+	for _, block := range ssa.Blocks {
+		for i, statement := range block.Statements {
+			if bufferInput(statement.Op) < 0 {
+				continue
+			}
+			encoding, buffer, ok := m.buffer(block, i)
+			if !ok {
+				continue
+			}
+			encodings[statement] = encoding
+			for _, store := range buffer {
+				stores[store] = true
+			}
+		}
+	}
+	
+	// Stores read by other statements stay
+	consumers := make(map[*Statement]bool)
+	for statement := range encodings {
+		consumers[statement] = true
+	}
+	removed := make(map[*Statement]bool)
+	for store := range stores {
+		if block, i := m.position(store); block != nil && m.onlyReadBy(block, i, consumers) {
+			removed[store] = true
+		}
+	}
+	for _, block := range ssa.Blocks {
+		for i, statement := range block.Statements {
+			if statement.Op == MSTORE && isConstant(statement.Inputs[0], 0x40) && allocationUnused(block, i) {
+				removed[statement] = true
+			}
+		}
+	}
+	m.remove(removed)
+	
+	for statement, encoding := range encodings {
+		input := bufferInput(statement.Op)
+		inputs := append([]Expression{}, statement.Inputs[:input]...)
+		inputs = append(inputs, encoding)
+		statement.Inputs = append(inputs, statement.Inputs[input + 2:]...)
+	}
+}
@@ -0,0 +1,47 @@
+package evmdis
+
+import (
+	"testing"
+)
+
+func TestOnlyReadByRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		collapse bool
+		expected bool
+	}{
+		{
+			// mem[0] = x; if (msg.value) mem[0x10] = 0; s[0] = mem[0x10]
+			// reads the end of x on the path that skips the overwrite
+			"joined paths",
+			"600035600052" + "3461000f57" + "61001956" + "5b600060105261001956" + "5b601051600055" + "00",
+			false,
+			false,
+		},
+		{
+			// mem[0] = x; mem[0x10] = 0; if (msg.value) s[0] = mem[0x10]
+			"overwritten before the jump",
+			"600035600052" + "6000601052" + "3461001157" + "00" + "5b601051600055" + "00",
+			true,
+			true,
+		},
+		{
+			// mem[0] = x; if (msg.value) s[0] = mem[0x10]; mem[0x10] = 0
+			"overwritten after the jump",
+			"600035600052" + "3461001157" + "6000601052" + "00" + "5b601051600055" + "00",
+			true,
+			false,
+		},
+	}
+	for _, test := range tests {
+		ssa := compileSSA(t, test.code)
+		if test.collapse {
+			ssa.CollapseJumps()
+		}
+		m := ssa.memoryAnalysis()
+		if ok := m.onlyReadBy(ssa.Blocks[0], 1, make(map[*Statement]bool)); ok != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, ok)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package evmdis
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// The compiler metadata Solidity appends to the runtime code. It is a
+// CBOR encoded map followed by its length as a two byte big endian
+// number:
+//
+//   a2 64 'ipfs' 58 22 <34 bytes> 64 'solc' 43 <3 bytes> 00 33
+//
+// Older compilers used a `bzzr0` or `bzzr1` swarm hash instead of ipfs.
+type Metadata struct {
+	IPFS            []byte
+	Bzzr0           []byte
+	Bzzr1           []byte
+	Solc            string
+	Experimental    bool
+	Extra           map[string]interface{}
+}
+
+func (metadata *Metadata) String() string {
+	str := ""
+	if metadata.Solc != "" {
+		str += fmt.Sprintf("solc %v ", metadata.Solc)
+	}
+	if metadata.IPFS != nil {
+		str += fmt.Sprintf("ipfs %x ", metadata.IPFS)
+	}
+	if metadata.Bzzr0 != nil {
+		str += fmt.Sprintf("bzzr0 %x ", metadata.Bzzr0)
+	}
+	if metadata.Bzzr1 != nil {
+		str += fmt.Sprintf("bzzr1 %x ", metadata.Bzzr1)
+	}
+	if metadata.Experimental {
+		str += "experimental "
+	}
+	keys := make([]string, 0, len(metadata.Extra))
+	for key := range metadata.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		str += fmt.Sprintf("%v %v ", key, metadata.Extra[key])
+	}
+	if len(str) > 0 {
+		str = str[:len(str) - 1]
+	}
+	return str
+}
+
+var metadataKeys = map[string]bool{
+	"ipfs":         true,
+	"bzzr0":        true,
+	"bzzr1":        true,
+	"solc":         true,
+	"experimental": true,
+}
+
+// Decodes a metadata blob, excluding the two length bytes.
+func DecodeMetadata(data []byte) (*Metadata, error) {
+	value, n, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(data) {
+		return nil, fmt.Errorf("%v trailing bytes after metadata", len(data) - n)
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok || len(fields) == 0 {
+		return nil, fmt.Errorf("Metadata is not a map")
+	}
+	
+	metadata := &Metadata{
+		Extra: make(map[string]interface{}),
+	}
+	known := 0
+	for key, value := range fields {
+		if metadataKeys[key] {
+			known++
+		}
+		switch key {
+		case "ipfs":
+			metadata.IPFS, _ = value.([]byte)
+		case "bzzr0":
+			metadata.Bzzr0, _ = value.([]byte)
+		case "bzzr1":
+			metadata.Bzzr1, _ = value.([]byte)
+		case "solc":
+			// Releases encode the version as three bytes, nightly
+			// builds as a full version string.
+			switch version := value.(type) {
+			case []byte:
+				if len(version) == 3 {
+					metadata.Solc = fmt.Sprintf("%v.%v.%v",
+						version[0], version[1], version[2])
+				} else {
+					metadata.Solc = hex.EncodeToString(version)
+				}
+			case string:
+				metadata.Solc = version
+			}
+		case "experimental":
+			metadata.Experimental, _ = value.(bool)
+		default:
+			metadata.Extra[key] = value
+		}
+	}
+	if known == 0 {
+		return nil, fmt.Errorf("Metadata has no known keys")
+	}
+	return metadata, nil
+}
+
+// Finds a metadata blob ending (including its length) right before
+// offset end. Returns the start offset of the blob or -1.
+func findMetadata(bytecode []byte, end int) (int, *Metadata) {
+	if end < 2 || end > len(bytecode) {
+		return -1, nil
+	}
+	length := int(binary.BigEndian.Uint16(bytecode[end - 2:end]))
+	start := end - 2 - length
+	if length == 0 || start < 0 {
+		return -1, nil
+	}
+	
+	// Quick check for a CBOR map header before decoding
+	if bytecode[start] < 0xa1 || bytecode[start] > 0xb7 {
+		return -1, nil
+	}
+	metadata, err := DecodeMetadata(bytecode[start:end - 2])
+	if err != nil {
+		return -1, nil
+	}
+	return start, metadata
+}
+
+// A minimal CBOR decoder supporting the subset used by compiler metadata:
+// unsigned integers, byte strings, text strings, maps and booleans.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	if len(data) == 0 {
+		return nil, 0, fmt.Errorf("Unexpected end of CBOR data")
+	}
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	
+	// Decode the argument
+	var argument uint64
+	n := 1
+	switch {
+	case info < 24:
+		argument = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < 1 + size {
+			return nil, 0, fmt.Errorf("Unexpected end of CBOR data")
+		}
+		for _, b := range data[1:1 + size] {
+			argument = argument << 8 | uint64(b)
+		}
+		n += size
+	default:
+		return nil, 0, fmt.Errorf("Unsupported CBOR argument %v", info)
+	}
+	
+	switch major {
+	case 0:
+		return argument, n, nil
+	case 2, 3:
+		if argument > uint64(len(data) - n) {
+			return nil, 0, fmt.Errorf("Unexpected end of CBOR data")
+		}
+		end := n + int(argument)
+		if major == 2 {
+			return append([]byte{}, data[n:end]...), end, nil
+		}
+		return string(data[n:end]), end, nil
+	case 5:
+		fields := make(map[string]interface{})
+		for i := uint64(0); i < argument; i++ {
+			key, size, err := decodeCBOR(data[n:])
+			if err != nil {
+				return nil, 0, err
+			}
+			n += size
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("Unsupported CBOR map key %v", key)
+			}
+			value, size, err := decodeCBOR(data[n:])
+			if err != nil {
+				return nil, 0, err
+			}
+			n += size
+			fields[name] = value
+		}
+		return fields, n, nil
+	case 7:
+		switch info {
+		case 20:
+			return false, n, nil
+		case 21:
+			return true, n, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("Unsupported CBOR item 0x%02X", data[0])
+}
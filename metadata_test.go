@@ -0,0 +1,20 @@
+package evmdis
+
+import (
+	"testing"
+)
+
+func TestMetadataString(t *testing.T) {
+	metadata := &Metadata{
+		Solc:  "0.8.24",
+		Extra: map[string]interface{}{"vyper": "0.3.10", "arbitrum": true, "license": "MIT", "build": 7},
+	}
+	expected := "solc 0.8.24 arbitrum true build 7 license MIT vyper 0.3.10"
+	
+	// Maps are iterated in a different order every time
+	for i := 0; i < 20; i++ {
+		if str := metadata.String(); str != expected {
+			t.Fatalf("expected %v, got %v", expected, str)
+		}
+	}
+}
@@ -45,7 +45,7 @@ func (op OpCode) IsLog() bool {
 
 func (op OpCode) IsControlFlow() bool {
 	switch op {
-	case JUMP, JUMPI, RETURN, SELFDESTRUCT, STOP:
+	case JUMP, JUMPI, RETURN, REVERT, INVALID, SELFDESTRUCT, STOP:
 		return true
 	}
 	return false
@@ -103,6 +103,9 @@ const (
 	XOR
 	NOT
 	BYTE
+	SHL
+	SHR
+	SAR
 )
 
 // 0x20 range - crypto
@@ -125,6 +128,9 @@ const (
 	GASPRICE
 	EXTCODESIZE
 	EXTCODECOPY
+	RETURNDATASIZE
+	RETURNDATACOPY
+	EXTCODEHASH
 )
 
 // 0x40 range - block operations
@@ -135,6 +141,11 @@ const (
 	NUMBER
 	DIFFICULTY
 	GASLIMIT
+	CHAINID
+	SELFBALANCE
+	BASEFEE
+	BLOBHASH
+	BLOBBASEFEE
 )
 
 // 0x50 range - 'storage' and execution
@@ -151,6 +162,10 @@ const (
 	MSIZE
 	GAS
 	JUMPDEST
+	TLOAD
+	TSTORE
+	MCOPY
+	PUSH0
 )
 
 // 0x60 range
@@ -237,8 +252,12 @@ const (
 	CALLCODE
 	RETURN
 	DELEGATECALL
+	CREATE2
 
-	SELFDESTRUCT = 0xff
+	STATICCALL   OpCode = 0xfa
+	REVERT       OpCode = 0xfd
+	INVALID      OpCode = 0xfe
+	SELFDESTRUCT OpCode = 0xff
 )
 
 // Since the opcodes aren't all in order we can't use a regular slice
@@ -267,6 +286,9 @@ var opCodeToString = map[OpCode]string{
 	OR:           "OR",
 	XOR:          "XOR",
 	BYTE:         "BYTE",
+	SHL:          "SHL",
+	SHR:          "SHR",
+	SAR:          "SAR",
 	ADDMOD:       "ADDMOD",
 	MULMOD:       "MULMOD",
 
@@ -285,6 +307,9 @@ var opCodeToString = map[OpCode]string{
 	CODESIZE:     "CODESIZE",
 	CODECOPY:     "CODECOPY",
 	GASPRICE:     "TXGASPRICE",
+	RETURNDATASIZE: "RETURNDATASIZE",
+	RETURNDATACOPY: "RETURNDATACOPY",
+	EXTCODEHASH:  "EXTCODEHASH",
 
 	// 0x40 range - block operations
 	BLOCKHASH:    "BLOCKHASH",
@@ -295,6 +320,11 @@ var opCodeToString = map[OpCode]string{
 	GASLIMIT:     "GASLIMIT",
 	EXTCODESIZE:  "EXTCODESIZE",
 	EXTCODECOPY:  "EXTCODECOPY",
+	CHAINID:      "CHAINID",
+	SELFBALANCE:  "SELFBALANCE",
+	BASEFEE:      "BASEFEE",
+	BLOBHASH:     "BLOBHASH",
+	BLOBBASEFEE:  "BLOBBASEFEE",
 
 	// 0x50 range - 'storage' and execution
 	POP:          "POP",
@@ -309,8 +339,12 @@ var opCodeToString = map[OpCode]string{
 	MSIZE:        "MSIZE",
 	GAS:          "GAS",
 	JUMPDEST:     "JUMPDEST",
+	TLOAD:        "TLOAD",
+	TSTORE:       "TSTORE",
+	MCOPY:        "MCOPY",
 
 	// 0x60 range - push
+	PUSH0:        "PUSH0",
 	PUSH1:        "PUSH1",
 	PUSH2:        "PUSH2",
 	PUSH3:        "PUSH3",
@@ -389,6 +423,10 @@ var opCodeToString = map[OpCode]string{
 	RETURN:       "RETURN",
 	CALLCODE:     "CALLCODE",
 	DELEGATECALL: "DELEGATECALL",
+	CREATE2:      "CREATE2",
+	STATICCALL:   "STATICCALL",
+	REVERT:       "REVERT",
+	INVALID:      "INVALID",
 	SELFDESTRUCT: "SELFDESTRUCT",
 }
 
@@ -419,13 +457,16 @@ var opCodeToStackReads = map[OpCode]int{
 	SGT:          2,
 	EQ:           2,
 	ISZERO:       1,
-	SIGNEXTEND:   1,
+	SIGNEXTEND:   2,
 
 	// 0x10 range - bit ops
 	AND:          2,
 	OR:           2,
 	XOR:          2,
 	BYTE:         2,
+	SHL:          2,
+	SHR:          2,
+	SAR:          2,
 	ADDMOD:       3,
 	MULMOD:       3,
 
@@ -444,6 +485,9 @@ var opCodeToStackReads = map[OpCode]int{
 	CODESIZE:     0,
 	CODECOPY:     3,
 	GASPRICE:     0,
+	RETURNDATASIZE: 0,
+	RETURNDATACOPY: 3,
+	EXTCODEHASH:  1,
 
 	// 0x40 range - block operations
 	BLOCKHASH:    1,
@@ -454,6 +498,11 @@ var opCodeToStackReads = map[OpCode]int{
 	GASLIMIT:     0,
 	EXTCODESIZE:  1,
 	EXTCODECOPY:  4,
+	CHAINID:      0,
+	SELFBALANCE:  0,
+	BASEFEE:      0,
+	BLOBHASH:     1,
+	BLOBBASEFEE:  0,
 
 	// 0x50 range - 'storage' and execution
 	POP:          1,
@@ -468,8 +517,12 @@ var opCodeToStackReads = map[OpCode]int{
 	MSIZE:        0,
 	GAS:          0,
 	JUMPDEST:     0,
+	TLOAD:        1,
+	TSTORE:       2,
+	MCOPY:        3,
 
 	// 0x60 range - push
+	PUSH0:        0,
 	PUSH1:        0,
 	PUSH2:        0,
 	PUSH3:        0,
@@ -547,7 +600,11 @@ var opCodeToStackReads = map[OpCode]int{
 	CALL:         7,
 	RETURN:       2,
 	CALLCODE:     7,
-	DELEGATECALL: 7,
+	DELEGATECALL: 6,
+	CREATE2:      4,
+	STATICCALL:   6,
+	REVERT:       2,
+	INVALID:      0,
 	SELFDESTRUCT: 1,
 }
 
@@ -580,6 +637,9 @@ var opCodeToStackWrites = map[OpCode]int{
 	OR:           1,
 	XOR:          1,
 	BYTE:         1,
+	SHL:          1,
+	SHR:          1,
+	SAR:          1,
 	ADDMOD:       1,
 	MULMOD:       1,
 
@@ -598,6 +658,9 @@ var opCodeToStackWrites = map[OpCode]int{
 	CODESIZE:     1,
 	CODECOPY:     0,
 	GASPRICE:     1,
+	RETURNDATASIZE: 1,
+	RETURNDATACOPY: 0,
+	EXTCODEHASH:  1,
 
 	// 0x40 range - block operations
 	BLOCKHASH:    1,
@@ -608,6 +671,11 @@ var opCodeToStackWrites = map[OpCode]int{
 	GASLIMIT:     1,
 	EXTCODESIZE:  1,
 	EXTCODECOPY:  0,
+	CHAINID:      1,
+	SELFBALANCE:  1,
+	BASEFEE:      1,
+	BLOBHASH:     1,
+	BLOBBASEFEE:  1,
 
 	// 0x50 range - 'storage' and execution
 	POP:          0,
@@ -622,8 +690,12 @@ var opCodeToStackWrites = map[OpCode]int{
 	MSIZE:        1,
 	GAS:          1,
 	JUMPDEST:     0,
+	TLOAD:        1,
+	TSTORE:       0,
+	MCOPY:        0,
 
 	// 0x60 range - push
+	PUSH0:        1,
 	PUSH1:        1,
 	PUSH2:        1,
 	PUSH3:        1,
@@ -702,6 +774,10 @@ var opCodeToStackWrites = map[OpCode]int{
 	RETURN:       0,
 	CALLCODE:     1,
 	DELEGATECALL: 1,
+	CREATE2:      1,
+	STATICCALL:   1,
+	REVERT:       0,
+	INVALID:      0,
 	SELFDESTRUCT: 0,
 }
 
@@ -840,6 +916,25 @@ var stringToOp = map[string]OpCode{
 	"RETURN":       RETURN,
 	"CALLCODE":     CALLCODE,
 	"SELFDESTRUCT": SELFDESTRUCT,
+	"SHL":          SHL,
+	"SHR":          SHR,
+	"SAR":          SAR,
+	"RETURNDATASIZE": RETURNDATASIZE,
+	"RETURNDATACOPY": RETURNDATACOPY,
+	"EXTCODEHASH":  EXTCODEHASH,
+	"CHAINID":      CHAINID,
+	"SELFBALANCE":  SELFBALANCE,
+	"BASEFEE":      BASEFEE,
+	"BLOBHASH":     BLOBHASH,
+	"BLOBBASEFEE":  BLOBBASEFEE,
+	"TLOAD":        TLOAD,
+	"TSTORE":       TSTORE,
+	"MCOPY":        MCOPY,
+	"PUSH0":        PUSH0,
+	"CREATE2":      CREATE2,
+	"STATICCALL":   STATICCALL,
+	"REVERT":       REVERT,
+	"INVALID":      INVALID,
 }
 
 func StringToOp(str string) OpCode {
@@ -0,0 +1,259 @@
+package evmdis
+
+import (
+	"fmt"
+)
+
+// Blocks are never widened beyond the maximum EVM stack depth
+const maxStackDepth = 1024
+
+// The blocks the stack flows in from. Blocks entered through a call or a
+// return see values of a different function, their inputs are left
+// alone and false is returned.
+func (ssa *SSAProgram) stackPredecessors(block *StatementBlock) ([]*StatementBlock, bool) {
+	predecessors := make([]*StatementBlock, 0)
+	for _, edge := range ssa.CFG.Predecessors(block) {
+		switch edge.Kind {
+		case CallEdge, ReturnEdge:
+			return nil, false
+		}
+	}
+	for _, node := range ssa.CFG.PredecessorNodes(block) {
+		predecessors = append(predecessors, node.(*StatementBlock))
+	}
+	return predecessors, len(predecessors) > 0
+}
+
+// Adds stack slots below the inputs that pass through the block untouched
+func (block *StatementBlock) widen(n int) {
+	extra := make([]Expression, n)
+	for i := range extra {
+		ssaCount++
+		extra[i] = Variable{
+			Label: fmt.Sprintf("a%v", ssaCount),
+		}
+	}
+	Prefix(&block.Inputs, extra)
+	Prefix(&block.Outputs, extra)
+	for i := range block.CondOutputs {
+		Prefix(&block.CondOutputs[i], extra)
+	}
+}
+
+// A block to widen the predecessors of, and the widening that made it
+// read more
+type widening struct {
+	block           *StatementBlock
+	cause           *widening
+}
+
+func (w *widening) causedBy(block *StatementBlock) bool {
+	for ; w != nil; w = w.cause {
+		if w.block == block {
+			return true
+		}
+	}
+	return false
+}
+
+// The stacks the block can leave with towards the target, one for every
+// jump or fall through to it
+func (block *StatementBlock) exitStacks(target *StatementBlock) [][]Expression {
+	stacks := make([][]Expression, 0)
+	for i, cond := range block.CondBlocks {
+		if cond == target && i < len(block.CondOutputs) {
+			stacks = append(stacks, block.CondOutputs[i])
+		}
+	}
+	exits := block.NextBlock == target
+	for _, other := range block.JumpTargets {
+		exits = exits || other == target
+	}
+	if exits {
+		stacks = append(stacks, block.Outputs)
+	}
+	return stacks
+}
+
+func expressionKey(expression Expression) string {
+	switch expression := expression.(type) {
+	case Constant:
+		return expression.String()
+	case Variable:
+		return expression.Label
+	}
+	return fmt.Sprintf("%v", expression)
+}
+
+// Connects the inputs of every block to the outputs of its predecessors.
+// Where values from different predecessors meet a phi node is inserted,
+// inputs that receive the same value from every predecessor are replaced
+// by that value. Must run after CollapseJumps and RecoverFunctions.
+func (ssa *SSAProgram) ConstructSSA() {
+	if ssa.CFG == nil {
+		ssa.ComputeIncoming()
+	}
+	
+	// Every predecessor must provide a value for every input. Blocks
+	// that read less than their successors are widened until the stack
+	// heights agree. A loop that leaves the stack lower than it found it
+	// would be widened again on every pass around it, so widening stops
+	// at a block that caused it.
+	work := make([]*widening, 0, len(ssa.Blocks))
+	for _, block := range ssa.Blocks {
+		work = append(work, &widening{block: block})
+	}
+	for len(work) > 0 {
+		item := work[len(work) - 1]
+		work = work[:len(work) - 1]
+		block := item.block
+		predecessors, ok := ssa.stackPredecessors(block)
+		if !ok {
+			continue
+		}
+		for _, predecessor := range predecessors {
+			missing := 0
+			for _, stack := range predecessor.exitStacks(block) {
+				if len(block.Inputs) - len(stack) > missing {
+					missing = len(block.Inputs) - len(stack)
+				}
+			}
+			if missing <= 0 || len(predecessor.Inputs) + missing > maxStackDepth {
+				continue
+			}
+			if item.causedBy(predecessor) {
+				continue
+			}
+			if _, ok := ssa.stackPredecessors(predecessor); !ok {
+				continue
+			}
+			predecessor.widen(missing)
+			work = append(work, &widening{block: predecessor, cause: item})
+		}
+	}
+	
+	// Insert a phi node for every input, deepest first
+	for _, block := range ssa.Blocks {
+		block.Phis = make([]*PhiNode, 0)
+		predecessors, ok := ssa.stackPredecessors(block)
+		if !ok {
+			continue
+		}
+		for i, input := range block.Inputs {
+			variable, ok := input.(Variable)
+			if !ok {
+				continue
+			}
+			depth := len(block.Inputs) - 1 - i
+			phi := &PhiNode{
+				Output: &variable,
+				Inputs: make([]Expression, 0),
+				Blocks: make([]*StatementBlock, 0),
+			}
+			// On a stack underflow, or if the predecessor leaves with
+			// different values towards the block, the input stays
+			// undefined
+			complete := true
+			for _, predecessor := range predecessors {
+				var value Expression
+				for _, stack := range predecessor.exitStacks(block) {
+					if depth >= len(stack) {
+						complete = false
+						break
+					}
+					other := stack[len(stack) - 1 - depth]
+					if value != nil && expressionKey(value) != expressionKey(other) {
+						complete = false
+						break
+					}
+					value = other
+				}
+				if !complete || value == nil {
+					complete = false
+					break
+				}
+				phi.Inputs = append(phi.Inputs, value)
+				phi.Blocks = append(phi.Blocks, predecessor)
+			}
+			if complete {
+				block.Phis = append(block.Phis, phi)
+			}
+		}
+	}
+	
+	// Remove phi nodes that select the same value on every path,
+	// ignoring the phi itself in loops
+	replacements := make(map[string]Expression)
+	resolve := func(expression Expression) Expression {
+		for {
+			variable, ok := expression.(Variable)
+			if !ok {
+				return expression
+			}
+			replacement, ok := replacements[variable.Label]
+			if !ok {
+				return expression
+			}
+			expression = replacement
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, block := range ssa.Blocks {
+			phis := make([]*PhiNode, 0)
+			for _, phi := range block.Phis {
+				var value Expression
+				unique := true
+				for _, input := range phi.Inputs {
+					input = resolve(input)
+					if expressionKey(input) == phi.Output.Label {
+						continue
+					}
+					if value != nil && expressionKey(value) != expressionKey(input) {
+						unique = false
+						break
+					}
+					value = input
+				}
+				if !unique || value == nil {
+					phis = append(phis, phi)
+					continue
+				}
+				replacements[phi.Output.Label] = value
+				changed = true
+			}
+			block.Phis = phis
+		}
+	}
+	
+	// Apply the replacements. Replaced inputs keep their stack slot so
+	// they stay in line with the outputs of the predecessors.
+	for _, block := range ssa.Blocks {
+		for i, input := range block.Inputs {
+			block.Inputs[i] = resolve(input)
+		}
+		for _, statement := range block.Statements {
+			for i, input := range statement.Inputs {
+				statement.Inputs[i] = resolve(input)
+			}
+		}
+		for _, phi := range block.Phis {
+			for i, input := range phi.Inputs {
+				phi.Inputs[i] = resolve(input)
+			}
+		}
+		for i, output := range block.Outputs {
+			block.Outputs[i] = resolve(output)
+		}
+		for _, outputs := range block.CondOutputs {
+			for i, output := range outputs {
+				outputs[i] = resolve(output)
+			}
+		}
+	}
+	for _, call := range ssa.Calls {
+		for i, argument := range call.Arguments {
+			call.Arguments[i] = resolve(argument)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package evmdis
+
+import (
+	"testing"
+)
+
+func blockAt(ssa *SSAProgram, offset int) *StatementBlock {
+	for _, block := range ssa.Blocks {
+		if block.Offset == offset {
+			return block
+		}
+	}
+	return nil
+}
+
+func TestConstructSSAKeepsInputSlots(t *testing.T) {
+	// Both paths reach the JUMPDEST at 0xA with 7 below a 1 or msg.value
+	ssa := compileSSA(t, "6007600134600a575034" + "5b0160005200")
+	ssa.ConstructSSA()
+	join := blockAt(ssa, 0xA)
+	if join == nil || len(join.Inputs) != 2 {
+		t.Fatalf("expected a join block with 2 inputs, got %v", join)
+	}
+	if !isConstant(join.Inputs[0], 7) {
+		t.Errorf("expected the deepest input to resolve to 0x7, got %v", join.Inputs[0])
+	}
+	if len(join.Phis) != 1 || expressionKey(join.Inputs[1]) != join.Phis[0].Output.Label {
+		t.Errorf("expected the top input to be a phi, got %v", join.Inputs[1])
+	}
+}
+
+func TestConstructSSAUnbalancedLoop(t *testing.T) {
+	// A loop popping one value more than it pushes on every iteration
+	ssa := compileSSA(t, "34" + "5b50600156")
+	ssa.ConstructSSA()
+	loop := blockAt(ssa, 1)
+	if loop == nil || len(loop.Inputs) > 2 {
+		t.Errorf("expected the loop to stop widening, got %v", loop)
+	}
+}
@@ -0,0 +1,44 @@
+package evmdis
+
+// Recursive descent disassembly. Starting from the entry point, follows
+// all jumps whose targets can be resolved to constants and marks every
+// block as reachable, unreachable or data. Unreachable blocks that do not
+// decode cleanly are considered data.
+func (program *Program) MarkReachable() {
+	reached := program.explore(func(state *abstractState, instruction *Instruction, args []abstractValue) bool {
+		return false
+	})
+	
+	for _, block := range program.Blocks {
+		switch {
+		case reached[block]:
+			block.Reach = Reachable
+		case block.isGarbage():
+			block.Reach = DataBlock
+		default:
+			block.Reach = Unreachable
+		}
+	}
+}
+
+// Returns a view of the program containing only the reachable blocks.
+// The blocks are shared with the linear sweep in program.Blocks.
+func (program *Program) RecursiveDescent() *Program {
+	view := *program
+	view.Blocks = make([]*BasicBlock, 0)
+	for _, block := range program.Blocks {
+		if block.Reach == Reachable {
+			view.Blocks = append(view.Blocks, block)
+		}
+	}
+	return &view
+}
+
+func (block *BasicBlock) isGarbage() bool {
+	for _, instruction := range block.Instructions {
+		if instruction.Undefined || instruction.Truncated {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package evmdis
+
+import (
+	"fmt"
+)
+
+type RegionKind int
+const (
+	CodeRegion RegionKind = iota // Instructions
+	RuntimeRegion                // Runtime code embedded in creation code
+	MetadataRegion               // CBOR compiler metadata
+	DataRegion                   // Trailing data, e.g. constructor arguments
+)
+
+var regionKindToString = map[RegionKind]string{
+	CodeRegion:     "code",
+	RuntimeRegion:  "runtime",
+	MetadataRegion: "metadata",
+	DataRegion:     "data",
+}
+
+func (kind RegionKind) String() string {
+	return regionKindToString[kind]
+}
+
+// A range of bytes in the program with a uniform interpretation
+type Region struct {
+	Kind            RegionKind
+	Offset          int
+	Size            int
+	Metadata        *Metadata // Decoded contents of a MetadataRegion
+}
+
+func (region Region) End() int {
+	return region.Offset + region.Size
+}
+
+func (region Region) Contains(offset int) bool {
+	return offset >= region.Offset && offset < region.End()
+}
+
+// Returns true if the region holds instructions of this program. The
+// runtime image is disassembled as a separate program.
+func (region Region) IsCode() bool {
+	return region.Kind == CodeRegion
+}
+
+func (region Region) String() string {
+	str := fmt.Sprintf("%v 0x%X-0x%X", region.Kind, region.Offset, region.End())
+	if region.Metadata != nil {
+		str += fmt.Sprintf(" (%v)", region.Metadata)
+	}
+	return str
+}
+
+func (program *Program) RegionAt(offset int) *Region {
+	for i := range program.Regions {
+		if program.Regions[i].Contains(offset) {
+			return &program.Regions[i]
+		}
+	}
+	return nil
+}
+
+// Splits the code into regions. The runtime image, if any, is found by
+// FindRuntime.
+func (program *Program) classifyRegions(image *Region) {
+	bytecode := program.Code
+	kinds := make([]RegionKind, len(bytecode))
+	
+	// Embedded runtime code
+	end := 0
+	if image != nil {
+		for i := image.Offset; i < image.End(); i++ {
+			kinds[i] = RuntimeRegion
+		}
+		end = image.End()
+	}
+	
+	// Compiler metadata ends the code, or the runtime image when followed
+	// by constructor arguments, with the two byte length of the blob.
+	metadata := make(map[int]*Metadata)
+	trailers := []int{len(bytecode)}
+	if image != nil && image.End() < len(bytecode) {
+		trailers = append(trailers, image.End())
+	}
+	for _, i := range trailers {
+		start, blob := findMetadata(bytecode, i)
+		if blob == nil {
+			continue
+		}
+		for j := start; j < i; j++ {
+			kinds[j] = MetadataRegion
+		}
+		metadata[start] = blob
+		if program.Metadata == nil {
+			program.Metadata = blob
+		}
+		if i > end {
+			end = i
+		}
+	}
+	
+	// Anything following the runtime image or metadata is data, for
+	// example ABI encoded constructor arguments.
+	if end > 0 {
+		for i := end; i < len(bytecode); i++ {
+			kinds[i] = DataRegion
+		}
+	}
+	
+	// Merge consecutive bytes of the same kind into regions
+	program.Regions = make([]Region, 0)
+	for i := 0; i < len(bytecode); {
+		j := i + 1
+		for j < len(bytecode) && kinds[j] == kinds[i] && metadata[j] == nil {
+			j++
+		}
+		program.Regions = append(program.Regions, Region{
+			Kind:     kinds[i],
+			Offset:   i,
+			Size:     j - i,
+			Metadata: metadata[i],
+		})
+		i = j
+	}
+}
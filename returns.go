@@ -0,0 +1,178 @@
+package evmdis
+
+type returnDecoder struct {
+	*memoryAnalysis
+	types           *typeInference
+	decoded         map[*Statement][]string // The types of every decoded return
+	stores          map[*Statement]bool     // Stores of the return data to remove
+}
+
+// The type of a static return value
+func (r *returnDecoder) valueType(value Expression) string {
+	if cast, ok := value.(*Cast); ok {
+		return cast.Type
+	}
+	if isBoolean(value) {
+		return "bool"
+	}
+	if statement := r.definition(value); statement != nil {
+		switch statement.Op {
+		case LT, GT, SLT, SGT, EQ, ISZERO:
+			return "bool"
+		}
+	}
+	return "uint256"
+}
+
+// Returns true if dynamic data of the length at the offset fits in the
+// returned data of the size. With a constant size only a constant length
+// can be shown to fit.
+func (r *returnDecoder) fits(offset int64, length Expression, size int64) bool {
+	constant, ok := length.(Constant)
+	if !ok {
+		return size < 0
+	}
+	return constant.Value.IsInt64() && (size < 0 || offset + 32 + dataSize(constant.Value.Int64()) <= size)
+}
+
+// The size of dynamic data of the length, padded to words
+func dataSize(length int64) int64 {
+	return (length + 31) / 32 * 32
+}
+
+// The offset of the length word a word of the head points to, if it can
+// be the offset of a dynamic value
+func (r *returnDecoder) tail(offset int64, word *memoryWord, words map[int64]*memoryWord, size int64) (int64, bool) {
+	tail, dynamic := int64(0), false
+	if constant, ok := word.Value.(Constant); ok && constant.Value.IsInt64() {
+		tail, dynamic = constant.Value.Int64(), true
+	} else if definition := r.definition(word.Value); definition != nil && definition.Op == SUB {
+		tail, dynamic = r.distance(definition.Inputs[1], definition.Inputs[0])
+	}
+	length, ok := words[tail]
+	if !dynamic || !ok || tail < offset + 32 || tail % 32 != 0 {
+		return 0, false
+	}
+	return tail, r.fits(tail, length.Value, size)
+}
+
+// Decodes the ABI encoded data of a return statement into the returned
+// values. Static values are the words of the head. Dynamic values have an
+// offset in the head to their length, followed by their data. The head
+// ends where the data of the first dynamic value starts, every word
+// before must be known. Without a constant size and dynamic values the
+// head ends at the first missing word.
+func (r *returnDecoder) decode(block *StatementBlock, index int) ([]Expression, []string, bool) {
+	statement := block.Statements[index]
+	start, ok := r.address(statement.Inputs[0])
+	if !ok {
+		return nil, nil, false
+	}
+	words := r.words(block, index, start)
+	size, ok := r.length(statement.Inputs[1])
+	if !ok || size < 0 {
+		size = -1
+	}
+	
+	// Find the end of the head
+	heads, bounded := size, size >= 0
+	for offset := int64(0); !bounded || offset < heads; offset += 32 {
+		word, ok := words[offset]
+		if !ok && bounded {
+			return nil, nil, false
+		}
+		if !ok {
+			heads = offset
+			break
+		}
+		if tail, ok := r.tail(offset, word, words, size); ok && (!bounded || tail < heads) {
+			heads, bounded = tail, true
+		}
+	}
+	
+	// Offsets to a length word at or after the end of the head and the
+	// data of the previous dynamic value are dynamic values
+	values := make([]Expression, 0)
+	types := make([]string, 0)
+	stores := make([]*Statement, 0)
+	next := heads
+	for offset := int64(0); offset < heads; offset += 32 {
+		word := words[offset]
+		if word.Local {
+			stores = append(stores, word.Store)
+		}
+		if tail, ok := r.tail(offset, word, words, size); ok && tail >= next {
+			length := words[tail]
+			next = tail + 32
+			if constant, ok := length.Value.(Constant); ok {
+				next += dataSize(constant.Value.Int64())
+			}
+			valueType := "bytes"
+			if r.types.isArrayLength(length.Value) {
+				valueType = "uint256[]"
+			}
+			
+			// The value is the memory the length word is stored at
+			values = append(values, &Cast{Type: valueType, Value: length.Store.Inputs[0]})
+			types = append(types, valueType)
+			continue
+		}
+		values = append(values, word.Value)
+		types = append(types, r.valueType(word.Value))
+	}
+	if size < 0 && len(values) == 0 {
+		return nil, nil, false
+	}
+	for _, store := range stores {
+		r.stores[store] = true
+	}
+	return values, types, true
+}
+
+// Decodes the data returned by the public functions into the values of
+// Solidity return statements and the return types of the functions.
+// Must run after Simplify, which turns masks into casts.
+func (ssa *SSAProgram) DecodeReturns() {
+	r := &returnDecoder{
+		memoryAnalysis: ssa.memoryAnalysis(),
+		types:          ssa.typeInference(),
+		decoded:        make(map[*Statement][]string),
+		stores:         make(map[*Statement]bool),
+	}
+	returns := make(map[*Statement][]Expression)
+	for _, function := range ssa.PublicFunctions {
+		if function.Kind != PublicFunctionKind {
+			continue
+		}
+		function.ReturnTypes = nil
+		for _, node := range ssa.functionCFG(function.Entry).Nodes {
+			block := node.(*StatementBlock)
+			for i, statement := range block.Statements {
+				if statement.Op != RETURN {
+					continue
+				}
+				types, ok := r.decoded[statement]
+				if !ok {
+					var values []Expression
+					if values, types, ok = r.decode(block, i); !ok {
+						continue
+					}
+					r.decoded[statement] = types
+					returns[statement] = values
+				}
+				if function.ReturnTypes == nil {
+					function.ReturnTypes = types
+				}
+			}
+		}
+	}
+	
+	// Remove the stores of the return data and return the values
+	r.remove(r.stores)
+	for statement, values := range returns {
+		statement.Inputs = values
+		if len(values) == 0 {
+			statement.Op = STOP
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package evmdis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeReturns(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		// return (1, 2)
+		{"static", "6001600052" + "6002602052" + "60406000f3", []string{"uint256", "uint256"}},
+		// return (0x20, msg.data[4]), the length of no data is unknown
+		{"offset and value", "6020600052" + "600435602052" + "60406000f3", []string{"uint256", "uint256"}},
+		// return bytes of 3 bytes
+		{"bytes", "6020600052" + "6003602052" + "600435604052" + "60606000f3", []string{"bytes"}},
+		// return (bytes(""), 0x40), the second offset points into the data of the first
+		{"overlapping", "6040600052" + "6040602052" + "6000604052" + "60606000f3", []string{"bytes", "uint256"}},
+		// return msg.data[4] != 0
+		{"bool", "6004351515600052" + "60206000f3", []string{"bool"}},
+	}
+	for _, test := range tests {
+		ssa := recoverContract(t, dispatcher + test.body)
+		if len(ssa.PublicFunctions) != 1 {
+			t.Fatalf("%v: expected one function, got %v", test.name, len(ssa.PublicFunctions))
+		}
+		if types := ssa.PublicFunctions[0].ReturnTypes; !reflect.DeepEqual(types, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, types)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package evmdis
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Signatures of widely used functions, always known to the resolver
+var bundledSignatures = []string{
+	// ERC-20
+	"totalSupply()",
+	"balanceOf(address)",
+	"transfer(address,uint256)",
+	"transferFrom(address,address,uint256)",
+	"approve(address,uint256)",
+	"allowance(address,address)",
+	"name()",
+	"symbol()",
+	"decimals()",
+	"increaseAllowance(address,uint256)",
+	"decreaseAllowance(address,uint256)",
+	"permit(address,address,uint256,uint256,uint8,bytes32,bytes32)",
+	"nonces(address)",
+	"DOMAIN_SEPARATOR()",
+	"mint(address,uint256)",
+	"burn(uint256)",
+	"burnFrom(address,uint256)",
+	"deposit()",
+	"withdraw(uint256)",
+	
+	// ERC-721 and ERC-1155
+	"ownerOf(uint256)",
+	"safeTransferFrom(address,address,uint256)",
+	"safeTransferFrom(address,address,uint256,bytes)",
+	"setApprovalForAll(address,bool)",
+	"getApproved(uint256)",
+	"isApprovedForAll(address,address)",
+	"tokenURI(uint256)",
+	"supportsInterface(bytes4)",
+	"balanceOf(address,uint256)",
+	"balanceOfBatch(address[],uint256[])",
+	"safeTransferFrom(address,address,uint256,uint256,bytes)",
+	"safeBatchTransferFrom(address,address,uint256[],uint256[],bytes)",
+	"uri(uint256)",
+	"onERC721Received(address,address,uint256,bytes)",
+	
+	// Ownership and access control
+	"owner()",
+	"transferOwnership(address)",
+	"renounceOwnership()",
+	"acceptOwnership()",
+	"pendingOwner()",
+	"hasRole(bytes32,address)",
+	"grantRole(bytes32,address)",
+	"revokeRole(bytes32,address)",
+	"renounceRole(bytes32,address)",
+	"getRoleAdmin(bytes32)",
+	"pause()",
+	"unpause()",
+	"paused()",
+	
+	// Proxies and common utilities
+	"implementation()",
+	"upgradeTo(address)",
+	"upgradeToAndCall(address,bytes)",
+	"initialize()",
+	"multicall(bytes[])",
+	"version()",
+	"kill()",
+}
+
+// Declarations of widely used events. ERC-721 indexes the last parameter
+// of Transfer and Approval, ERC-20 does not.
+var bundledEvents = []string{
+	"Transfer(address indexed,address indexed,uint256)",
+	"Transfer(address indexed,address indexed,uint256 indexed)",
+	"Approval(address indexed,address indexed,uint256)",
+	"Approval(address indexed,address indexed,uint256 indexed)",
+	"ApprovalForAll(address indexed,address indexed,bool)",
+	"TransferSingle(address indexed,address indexed,address indexed,uint256,uint256)",
+	"TransferBatch(address indexed,address indexed,address indexed,uint256[],uint256[])",
+	"URI(string,uint256 indexed)",
+	"OwnershipTransferred(address indexed,address indexed)",
+	"OwnershipTransferStarted(address indexed,address indexed)",
+	"RoleGranted(bytes32 indexed,address indexed,address indexed)",
+	"RoleRevoked(bytes32 indexed,address indexed,address indexed)",
+	"RoleAdminChanged(bytes32 indexed,bytes32 indexed,bytes32 indexed)",
+	"Paused(address)",
+	"Unpaused(address)",
+	"Deposit(address indexed,uint256)",
+	"Withdrawal(address indexed,uint256)",
+	"Upgraded(address indexed)",
+	"AdminChanged(address,address)",
+	"BeaconUpgraded(address indexed)",
+	"Initialized(uint8)",
+	"Initialized(uint64)",
+}
+
+// Function names and argument lists combined when guessing selectors that
+// are not in the database
+var guessNames = []string{
+	"get", "set", "add", "remove", "update", "create", "delete", "register",
+	"claim", "stake", "unstake", "lock", "unlock", "buy", "sell", "bid",
+	"vote", "execute", "cancel", "start", "stop", "finalize", "refund",
+	"deposit", "withdraw", "transfer", "approve", "mint", "burn", "send",
+	"pay", "fund", "release", "destroy", "kill", "close", "open", "reset",
+	"value", "data", "count", "balance", "balances", "owner", "admin",
+	"price", "amount", "total", "rate", "fee", "end", "deadline",
+	"setOwner", "changeOwner", "getOwner", "setAdmin", "getBalance",
+	"setPrice", "getPrice", "setValue", "getValue", "setData", "getData",
+	"setFee", "getCount", "increment", "decrement", "store", "retrieve",
+	"greet", "setGreeting", "message", "setMessage", "hello", "test",
+	"enter", "play", "winner", "players", "users", "tokens", "items",
+	"withdrawAll", "emergencyWithdraw", "sweep", "collect", "payout",
+}
+
+var guessArguments = []string{
+	"",
+	"uint256", "address", "bool", "bytes32", "string", "bytes", "uint8",
+	"int256", "uint256[]", "address[]",
+	"address,uint256", "uint256,uint256", "address,address", "address,bool",
+	"uint256,address", "bytes32,uint256", "string,string", "address,string",
+	"address,address,uint256", "address,uint256,uint256", "uint256,uint256,uint256",
+}
+
+// Maps function selectors to the signatures they are the hash of, and
+// event topics to the signatures of the events. Several signatures can
+// share a selector.
+type SignatureDatabase struct {
+	signatures      map[uint32][]string
+	events          map[string]string   // By the hex of the topic
+	indexed         map[string][][]bool // Indexed parameters of every declaration of an event
+	guesses         map[uint32][]string // Built on the first guess
+}
+
+// A database with the bundled signatures
+func NewSignatureDatabase() *SignatureDatabase {
+	db := &SignatureDatabase{
+		signatures: make(map[uint32][]string),
+		events:     make(map[string]string),
+		indexed:    make(map[string][][]bool),
+	}
+	for _, signature := range bundledSignatures {
+		db.Add(signature)
+	}
+	for _, declaration := range bundledEvents {
+		db.addEventDeclaration(declaration)
+	}
+	return db
+}
+
+func (db *SignatureDatabase) Add(signature string) {
+	db.addWithSelector(Selector(signature), signature)
+}
+
+func (db *SignatureDatabase) addWithSelector(selector uint32, signature string) {
+	for _, other := range db.signatures[selector] {
+		if other == signature {
+			return
+		}
+	}
+	db.signatures[selector] = append(db.signatures[selector], signature)
+}
+
+// Adds the signature of an event, its topic is the whole hash
+func (db *SignatureDatabase) AddEvent(signature string) {
+	hash := Keccak256([]byte(signature))
+	db.events[hex.EncodeToString(hash[:])] = signature
+}
+
+// Adds an event with the parameters that are indexed
+func (db *SignatureDatabase) addIndexed(signature string, indexed []bool) {
+	db.AddEvent(signature)
+	for _, other := range db.indexed[signature] {
+		if reflect.DeepEqual(other, indexed) {
+			return
+		}
+	}
+	db.indexed[signature] = append(db.indexed[signature], indexed)
+}
+
+// Adds an event declared like "URI(string,uint256 indexed)"
+func (db *SignatureDatabase) addEventDeclaration(declaration string) {
+	name, parameters := splitSignature(declaration)
+	types := make([]string, len(parameters))
+	indexed := make([]bool, len(parameters))
+	for i, parameter := range parameters {
+		types[i] = strings.TrimSuffix(parameter, " indexed")
+		indexed[i] = types[i] != parameter
+	}
+	db.addIndexed(fmt.Sprintf("%v(%v)", name, strings.Join(types, ",")), indexed)
+}
+
+func parseSelector(str string) (uint32, error) {
+	selector, err := strconv.ParseUint(strings.TrimPrefix(str, "0x"), 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid selector %q", str)
+	}
+	return uint32(selector), nil
+}
+
+// The hex of an event topic, which is longer than a selector
+func parseTopic(str string) (string, bool) {
+	str = strings.ToLower(strings.TrimPrefix(str, "0x"))
+	if _, err := hex.DecodeString(str); err != nil || len(str) != 64 {
+		return "", false
+	}
+	return str, true
+}
+
+// Loads signatures from a file. JSON files are either an ABI or an object
+// mapping selectors or event topics to lists of signatures. Text files
+// have a function signature per line, optionally after its selector, or an
+// event signature after its topic or the word event as in
+// "event Transfer(address indexed,address indexed,uint256)"; lines
+// starting with '#' are comments.
+func (db *SignatureDatabase) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	
+	reader := bufio.NewReader(file)
+	for {
+		c, err := reader.Peek(1)
+		if err != nil {
+			return nil
+		}
+		switch c[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.ReadByte()
+			continue
+		case '[':
+			return db.LoadABI(reader)
+		case '{':
+			return db.loadJSON(reader)
+		}
+		return db.loadText(reader)
+	}
+}
+
+func (db *SignatureDatabase) loadText(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "event" && len(fields) > 1 {
+			db.addEventDeclaration(strings.Join(fields[1:], " "))
+			continue
+		}
+		switch len(fields) {
+		case 1:
+			db.Add(fields[0])
+		case 2:
+			if topic, ok := parseTopic(fields[0]); ok {
+				db.events[topic] = fields[1]
+				continue
+			}
+			selector, err := parseSelector(fields[0])
+			if err != nil {
+				return fmt.Errorf("Line %v: %v", line, err)
+			}
+			db.addWithSelector(selector, fields[1])
+		default:
+			return fmt.Errorf("Line %v: Expected a signature, optionally after its selector or topic", line)
+		}
+	}
+	return scanner.Err()
+}
+
+func (db *SignatureDatabase) loadJSON(reader io.Reader) error {
+	var entries map[string][]string
+	if err := json.NewDecoder(reader).Decode(&entries); err != nil {
+		return err
+	}
+	for key, signatures := range entries {
+		if topic, ok := parseTopic(key); ok && len(signatures) > 0 {
+			db.events[topic] = signatures[0]
+			continue
+		}
+		selector, err := parseSelector(key)
+		if err != nil {
+			return err
+		}
+		for _, signature := range signatures {
+			db.addWithSelector(selector, signature)
+		}
+	}
+	return nil
+}
+
+// A parameter in an ABI JSON file
+type abiParameter struct {
+	Name            string         `json:"name"`
+	Type            string         `json:"type"`
+	Indexed         bool           `json:"indexed,omitempty"`
+	Components      []abiParameter `json:"components,omitempty"`
+}
+
+// The canonical type of the parameter, tuples are written out
+func (parameter abiParameter) canonicalType() string {
+	if !strings.HasPrefix(parameter.Type, "tuple") {
+		return parameter.Type
+	}
+	components := make([]string, len(parameter.Components))
+	for i, component := range parameter.Components {
+		components[i] = component.canonicalType()
+	}
+	return "(" + strings.Join(components, ",") + ")" + strings.TrimPrefix(parameter.Type, "tuple")
+}
+
+type abiEntry struct {
+	Type            string         `json:"type"`
+	Name            string         `json:"name,omitempty"`
+	Inputs          []abiParameter `json:"inputs"`
+	Outputs         []abiParameter `json:"outputs"`
+	StateMutability string         `json:"stateMutability,omitempty"`
+}
+
+// Loads the functions and events of a contract ABI in the JSON format
+// solc writes
+func (db *SignatureDatabase) LoadABI(reader io.Reader) error {
+	var entries []abiEntry
+	if err := json.NewDecoder(reader).Decode(&entries); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		types := make([]string, len(entry.Inputs))
+		indexed := make([]bool, len(entry.Inputs))
+		for i, input := range entry.Inputs {
+			types[i] = input.canonicalType()
+			indexed[i] = input.Indexed
+		}
+		signature := fmt.Sprintf("%v(%v)", entry.Name, strings.Join(types, ","))
+		switch entry.Type {
+		case "function", "":
+			db.Add(signature)
+		case "event":
+			db.addIndexed(signature, indexed)
+		}
+	}
+	return nil
+}
+
+// The known signatures with the selector, sorted
+func (db *SignatureDatabase) Lookup(selector uint32) []string {
+	signatures := append([]string{}, db.signatures[selector]...)
+	sort.Strings(signatures)
+	return signatures
+}
+
+// Tries the combinations of common names and argument lists
+func (db *SignatureDatabase) Guess(selector uint32) []string {
+	if db.guesses == nil {
+		db.guesses = make(map[uint32][]string)
+		for _, name := range guessNames {
+			for _, arguments := range guessArguments {
+				signature := fmt.Sprintf("%v(%v)", name, arguments)
+				db.guesses[Selector(signature)] = append(db.guesses[Selector(signature)], signature)
+			}
+		}
+	}
+	signatures := append([]string{}, db.guesses[selector]...)
+	sort.Strings(signatures)
+	return signatures
+}
+
+// The signature of the selector from the database, or guessed, and
+// whether it was guessed. Returns false if neither finds one.
+func (db *SignatureDatabase) Resolve(selector uint32) (string, bool, bool) {
+	if signatures := db.Lookup(selector); len(signatures) > 0 {
+		return signatures[0], false, true
+	}
+	if signatures := db.Guess(selector); len(signatures) > 0 {
+		return signatures[0], true, true
+	}
+	return "", false, false
+}
+
+// The signature of the event with the topic, and which of its parameters
+// are indexed in the declaration that indexes the number of parameters.
+// Events without a declaration index none. Returns false if the topic or
+// such a declaration is not known.
+func (db *SignatureDatabase) ResolveEvent(topic *big.Int, indexedCount int) (string, []bool, bool) {
+	signature, ok := db.events[fmt.Sprintf("%064x", topic)]
+	if !ok {
+		return "", nil, false
+	}
+	_, types := splitSignature(signature)
+	declarations := db.indexed[signature]
+	if len(declarations) == 0 {
+		declarations = [][]bool{make([]bool, len(types))}
+	}
+	for _, indexed := range declarations {
+		count := 0
+		for _, isIndexed := range indexed {
+			if isIndexed {
+				count++
+			}
+		}
+		if count == indexedCount && len(indexed) == len(types) {
+			return signature, indexed, true
+		}
+	}
+	return "", nil, false
+}
+
+// Splits a signature into the function name and the argument types
+func splitSignature(signature string) (string, []string) {
+	open := strings.Index(signature, "(")
+	if open < 0 || !strings.HasSuffix(signature, ")") {
+		return signature, nil
+	}
+	name := signature[:open]
+	arguments := signature[open + 1:len(signature) - 1]
+	types := make([]string, 0)
+	depth := 0
+	start := 0
+	for i, c := range arguments {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				types = append(types, arguments[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if arguments != "" {
+		types = append(types, arguments[start:])
+	}
+	return name, types
+}
@@ -0,0 +1,108 @@
+package evmdis
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeccak256(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{"", "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{"abc", "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+		{"Transfer(address,address,uint256)", "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"},
+	}
+	for _, test := range tests {
+		hash := Keccak256([]byte(test.data))
+		if str := hex.EncodeToString(hash[:]); str != test.expected {
+			t.Errorf("keccak256(%q): expected %v, got %v", test.data, test.expected, str)
+		}
+	}
+}
+
+func TestSelector(t *testing.T) {
+	tests := []struct {
+		signature string
+		expected  uint32
+	}{
+		{"transfer(address,uint256)", 0xa9059cbb},
+		{"approve(address,uint256)", 0x095ea7b3},
+		{"balanceOf(address)", 0x70a08231},
+	}
+	for _, test := range tests {
+		if selector := Selector(test.signature); selector != test.expected {
+			t.Errorf("%v: expected %08x, got %08x", test.signature, test.expected, selector)
+		}
+	}
+}
+
+func TestResolveGuessed(t *testing.T) {
+	db := NewSignatureDatabase()
+	tests := []struct {
+		selector  uint32
+		signature string
+		guessed   bool
+		ok        bool
+	}{
+		{0xa9059cbb, "transfer(address,uint256)", false, true},
+		{Selector("unlock(address,uint256)"), "unlock(address,uint256)", true, true},
+		{0x00000000, "", false, false},
+	}
+	for _, test := range tests {
+		signature, guessed, ok := db.Resolve(test.selector)
+		if signature != test.signature || guessed != test.guessed || ok != test.ok {
+			t.Errorf("%08x: expected %q %v %v, got %q %v %v", test.selector,
+				test.signature, test.guessed, test.ok, signature, guessed, ok)
+		}
+	}
+}
+
+func TestLoadText(t *testing.T) {
+	db := NewSignatureDatabase()
+	text := "# Functions and events\n" +
+		"store(uint256)\n" +
+		"0x12345678 retrieve()\n" +
+		"event Stored(address indexed,uint256)\n" +
+		"\n" +
+		"0x" + fmt.Sprintf("%x", Keccak256([]byte("Cleared()"))) + " Cleared()\n"
+	if err := db.loadText(strings.NewReader(text)); err != nil {
+		t.Fatal(err)
+	}
+	functions := []struct {
+		selector  uint32
+		expected  string
+	}{
+		{Selector("store(uint256)"), "store(uint256)"},
+		{0x12345678, "retrieve()"},
+		{Selector("Stored(address,uint256)"), ""},
+	}
+	for _, test := range functions {
+		if signatures := db.Lookup(test.selector); strings.Join(signatures, " ") != test.expected {
+			t.Errorf("%08x: expected function %q, got %v", test.selector, test.expected, signatures)
+		}
+	}
+	events := []struct {
+		signature string
+		indexed   []bool
+		ok        bool
+	}{
+		{"Stored(address,uint256)", []bool{true, false}, true},
+		{"Cleared()", []bool{}, true},
+		{"store(uint256)", nil, false},
+	}
+	for _, test := range events {
+		hash := Keccak256([]byte(test.signature))
+		topic := new(big.Int).SetBytes(hash[:])
+		signature, indexed, ok := db.ResolveEvent(topic, strings.Count(fmt.Sprint(test.indexed), "true"))
+		if ok != test.ok || ok && (signature != test.signature || !reflect.DeepEqual(indexed, test.indexed)) {
+			t.Errorf("%v: expected event %v %v, got %q %v %v", test.signature, test.indexed, test.ok, signature,
+				indexed, ok)
+		}
+	}
+}
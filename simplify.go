@@ -0,0 +1,260 @@
+package evmdis
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// The Solidity type of a value masked to the lowest n bits
+func maskType(bits int) string {
+	if bits == 160 {
+		return "address"
+	}
+	return fmt.Sprintf("uint%v", bits)
+}
+
+// Returns n if the value is a mask of the lowest n bits, for whole bytes
+// only
+func maskBits(value *big.Int) (int, bool) {
+	bits := value.BitLen()
+	if bits == 0 || bits % 8 != 0 || value.Cmp(lowMask(uint(bits))) != 0 {
+		return 0, false
+	}
+	return bits, true
+}
+
+func isConstant(expression Expression, value int64) bool {
+	constant, ok := expression.(Constant)
+	return ok && constant.Value.Cmp(big.NewInt(value)) == 0
+}
+
+// Simplifies a statement given its resolved inputs. Returns the
+// expression the output can be replaced with, or nil.
+func (ssa *SSAProgram) simplify(statement *Statement, definitions map[string]*Statement) Expression {
+	args := statement.Inputs
+	
+	// Constant folding
+	values := make([]*big.Int, len(args))
+	constant := true
+	for i, arg := range args {
+		if c, ok := arg.(Constant); ok {
+			values[i] = c.Value
+		} else {
+			constant = false
+		}
+	}
+	if constant {
+		if value, ok := Evaluate(statement.Op, values...); ok {
+			return Constant{Value: value}
+		}
+		return nil
+	}
+	
+	// Algebraic identities, constants can be on either side
+	switch statement.Op {
+	case ADD, OR, XOR:
+		if isConstant(args[0], 0) {
+			return args[1]
+		}
+		if isConstant(args[1], 0) {
+			return args[0]
+		}
+	case MUL:
+		if isConstant(args[0], 1) {
+			return args[1]
+		}
+		if isConstant(args[1], 1) {
+			return args[0]
+		}
+		if isConstant(args[0], 0) || isConstant(args[1], 0) {
+			return Constant{Value: big.NewInt(0)}
+		}
+	case SUB, SHL, SHR, SAR:
+		// The shift amount is the first argument
+		if statement.Op == SUB && isConstant(args[1], 0) {
+			return args[0]
+		}
+		if statement.Op != SUB && isConstant(args[0], 0) {
+			return args[1]
+		}
+	case DIV, SDIV:
+		if isConstant(args[1], 1) {
+			return args[0]
+		}
+	case AND:
+		for i, arg := range args {
+			c, ok := arg.(Constant)
+			if !ok {
+				continue
+			}
+			other := args[1 - i]
+			if c.Value.Sign() == 0 {
+				return Constant{Value: big.NewInt(0)}
+			}
+			if bits, ok := maskBits(c.Value); ok {
+				if bits == 256 {
+					return other
+				}
+				return &Cast{Type: maskType(bits), Value: other}
+			}
+		}
+	case SIGNEXTEND:
+		if c, ok := args[0].(Constant); ok && c.Value.IsInt64() && c.Value.Int64() < 31 {
+			return &Cast{
+				Type:  fmt.Sprintf("int%v", (c.Value.Int64() + 1) * 8),
+				Value: args[1],
+			}
+		}
+	case ISZERO:
+		// Two negations of a boolean are the boolean itself, which also
+		// makes three negations one
+		inner, ok := args[0].(Variable)
+		if !ok || definitions[inner.Label] == nil || definitions[inner.Label].Op != ISZERO {
+			break
+		}
+		innermost := definitions[inner.Label].Inputs[0]
+		if isBooleanVariable(innermost, definitions) {
+			return innermost
+		}
+	}
+	return nil
+}
+
+// Returns true if the variable is the result of a comparison, so either
+// zero or one
+func isBooleanVariable(expression Expression, definitions map[string]*Statement) bool {
+	variable, ok := expression.(Variable)
+	if !ok || definitions[variable.Label] == nil {
+		return false
+	}
+	switch definitions[variable.Label].Op {
+	case LT, GT, SLT, SGT, EQ, ISZERO:
+		return true
+	}
+	return false
+}
+
+// Folds operations on constants with EVM semantics and simplifies
+// algebraic identities. Masks and sign extensions become type casts.
+// Statements whose value is known are removed and the value is used
+// instead. Double negations of booleans, and of any value in conditions,
+// are removed.
+func (ssa *SSAProgram) Simplify() {
+	definitions := make(map[string]*Statement)
+	for _, block := range ssa.Blocks {
+		for _, statement := range block.Statements {
+			if statement.Output != nil {
+				definitions[statement.Output.Label] = statement
+			}
+		}
+	}
+	
+	// Every use gets its own copy of a cast, later passes change them
+	replacements := make(map[string]Expression)
+	var resolve func(expression Expression) Expression
+	resolve = func(expression Expression) Expression {
+		for {
+			if cast, ok := expression.(*Cast); ok {
+				return &Cast{
+					Type:  cast.Type,
+					Value: resolve(cast.Value),
+				}
+			}
+			variable, ok := expression.(Variable)
+			if !ok {
+				return expression
+			}
+			replacement, ok := replacements[variable.Label]
+			if !ok {
+				return expression
+			}
+			expression = replacement
+		}
+	}
+	
+	for changed := true; changed; {
+		changed = false
+		for _, block := range ssa.Blocks {
+			statements := make([]*Statement, 0)
+			for _, statement := range block.Statements {
+				for i, input := range statement.Inputs {
+					statement.Inputs[i] = resolve(input)
+				}
+				if statement.Output != nil && statement.Op.writes() == 0 {
+					if value := ssa.simplify(statement, definitions); value != nil {
+						replacements[statement.Output.Label] = value
+						changed = true
+						continue
+					}
+				}
+				statements = append(statements, statement)
+			}
+			block.Statements = statements
+			
+			// Phi nodes selecting the same constant on every path
+			phis := make([]*PhiNode, 0)
+			for _, phi := range block.Phis {
+				var value Expression
+				unique := true
+				for i, input := range phi.Inputs {
+					phi.Inputs[i] = resolve(input)
+					if value != nil && expressionKey(value) != expressionKey(phi.Inputs[i]) {
+						unique = false
+					}
+					value = phi.Inputs[i]
+				}
+				if _, ok := value.(Constant); ok && unique {
+					replacements[phi.Output.Label] = value
+					changed = true
+					continue
+				}
+				phis = append(phis, phi)
+			}
+			block.Phis = phis
+		}
+	}
+	
+	// Conditions only test for zero, double negations can be dropped
+	for _, block := range ssa.Blocks {
+		for _, statement := range block.Statements {
+			if statement.Op != JUMPI {
+				continue
+			}
+			condition, ok := statement.Inputs[1].(Variable)
+			if !ok || definitions[condition.Label] == nil || definitions[condition.Label].Op != ISZERO {
+				continue
+			}
+			inner, ok := definitions[condition.Label].Inputs[0].(Variable)
+			if !ok || definitions[inner.Label] == nil || definitions[inner.Label].Op != ISZERO {
+				continue
+			}
+			statement.Inputs[1] = resolve(definitions[inner.Label].Inputs[0])
+		}
+	}
+	
+	// Use the values in the rest of the program. Replaced inputs keep
+	// their stack slot.
+	for _, block := range ssa.Blocks {
+		for i, input := range block.Inputs {
+			block.Inputs[i] = resolve(input)
+		}
+		for _, phi := range block.Phis {
+			for i, input := range phi.Inputs {
+				phi.Inputs[i] = resolve(input)
+			}
+		}
+		for i, output := range block.Outputs {
+			block.Outputs[i] = resolve(output)
+		}
+		for _, outputs := range block.CondOutputs {
+			for i, output := range outputs {
+				outputs[i] = resolve(output)
+			}
+		}
+	}
+	for _, call := range ssa.Calls {
+		for i, argument := range call.Arguments {
+			call.Arguments[i] = resolve(argument)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package evmdis
+
+import (
+	"testing"
+)
+
+func storedValues(ssa *SSAProgram) []Expression {
+	values := make([]Expression, 0)
+	for _, block := range ssa.Blocks {
+		for _, statement := range block.Statements {
+			if statement.Op == SSTORE {
+				values = append(values, statement.Inputs[1])
+			}
+		}
+	}
+	return values
+}
+
+func TestSimplifyCastPerUse(t *testing.T) {
+	// x = address(msg.data[0]); s[0] = x; s[1] = x;
+	ssa := compileSSA(t, "600035" + "73ffffffffffffffffffffffffffffffffffffffff16" + "8060005560015500")
+	ssa.ConstructSSA()
+	ssa.Simplify()
+	values := storedValues(ssa)
+	if len(values) != 2 {
+		t.Fatalf("expected 2 stores, got %v", values)
+	}
+	first, ok1 := values[0].(*Cast)
+	second, ok2 := values[1].(*Cast)
+	if !ok1 || !ok2 || first.Type != "address" || second.Type != "address" {
+		t.Fatalf("expected two address casts, got %v", values)
+	}
+	if first == second {
+		t.Errorf("both uses share one cast")
+	}
+}
+
+func TestSimplifyDoubleNegation(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		op      OpCode // The definition of the stored value
+	}{
+		// s[0] = !!(msg.data[1] < msg.data[0])
+		{"boolean", "600035600135101515600055" + "00", LT},
+		// s[0] = !!msg.data[0] normalizes the value to a bool
+		{"value", "6000351515600055" + "00", ISZERO},
+	}
+	for _, test := range tests {
+		ssa := compileSSA(t, test.code)
+		ssa.ConstructSSA()
+		ssa.Simplify()
+		values := storedValues(ssa)
+		if len(values) != 1 {
+			t.Fatalf("%v: expected 1 store, got %v", test.name, values)
+		}
+		variable, ok := values[0].(Variable)
+		definition := ssa.definitions()[variable.Label]
+		if !ok || definition == nil || definition.Op != test.op {
+			t.Errorf("%v: expected a value computed by %v, got %v", test.name, test.op, values[0])
+		}
+	}
+}
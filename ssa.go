@@ -4,6 +4,7 @@ import (
 	"log"
 	"fmt"
 	"math/big"
+	"strings"
 )
 
 type Expression interface {
@@ -14,8 +15,52 @@ type Constant struct {
 	Value      *big.Int
 }
 
+// An operation used as the value of an expression, a statement that
+// was folded into the statement using its result
+type Operation struct {
+	Expression
+	Op         OpCode
+	Inputs     []Expression
+}
+
+func (operation *Operation) String() string {
+	str, _ := render(operation.Op, operation.Inputs)
+	return str
+}
+
+// A value converted to a narrower Solidity type, recovered from masks and
+// sign extensions
+type Cast struct {
+	Expression
+	Type       string
+	Value      Expression
+}
+
+func (cast *Cast) String() string {
+	// Constants converted to booleans are literals
+	if constant, ok := cast.Value.(Constant); ok && cast.Type == "bool" {
+		return fmt.Sprintf("%v", constant.Value.Sign() != 0)
+	}
+	return fmt.Sprintf("%v(%v)", cast.Type, cast.Value)
+}
+
+// The randomness of the beacon chain, which DIFFICULTY returns from Paris
+// on
+type Randomness struct {
+	Expression
+}
+
+func (randomness *Randomness) String() string {
+	return "block.prevrandao"
+}
+
+// Selects the value that flowed in from the predecessor control came
+// from. Inputs[i] is the value coming from Blocks[i].
 type PhiNode struct {
 	Expression
+	Output     *Variable
+	Inputs     []Expression
+	Blocks     []*StatementBlock
 }
 
 type Variable struct {
@@ -27,16 +72,25 @@ type Statement struct {
 	Op         OpCode
 	Inputs     []Expression
 	Output     *Variable // Statements can have max one output on the stack.
+	Targets    []int     // Resolved destinations of a computed jump
 }
 
 type opCodeConvention int
 const (
-	NULLARY opCodeConvention = iota
-	UNARY
-	BINARY
-	FUNCTION
-	FIELD
-	MEMBER
+	NULLARY opCodeConvention = iota // A global value, 'msg.sender'
+	UNARY                           // Prefix operator, '~a'
+	BINARY                          // Infix operator, 'a + b'
+	SIGNED                          // Infix operator on signed values, 'uint256(int256(a) / int256(b))'
+	SHIFT                           // Shift of the second input by the first, 'b << a'
+	SIGNEDSHIFT                     // Arithmetic shift, 'uint256(int256(b) >> a)'
+	NEGATION                        // '!a' for booleans, 'a == 0' otherwise
+	FUNCTION                        // Function call, 'f(a, b)'
+	FIELD                           // Member of an address, 'address(a).balance'
+	MEMBER                          // Method called on the first input, 'a.f(b)'
+	INDEX                           // Byte of the second input, 'a < 0x20 ? uint8(bytes32(b)[a]) : 0x0'
+	CALLDATA                        // Word of the call data, 'uint(bytes32(msg.data[a:]))'
+	EXTENSION                       // Sign extension of the second input from byte a
+	HASH                            // Hash of memory, 'keccak256(memory[a:a + b])'
 )
 
 type opCodeInfoRecord struct {
@@ -44,65 +98,89 @@ type opCodeInfoRecord struct {
 	Solidity      string
 }
 
+// Opcodes without a Solidity equivalent use the inline assembly (Yul)
+// builtin of the same name
 var opCodeInfo = map[OpCode]opCodeInfoRecord{
+	STOP:         {NULLARY,  "return"},
 	ADD:          {BINARY,   "+"},
 	MUL:          {BINARY,   "*"},
 	SUB:          {BINARY,   "-"},
 	DIV:          {BINARY,   "/"},
-	SDIV:         {BINARY,   "/"}, // signed
+	SDIV:         {SIGNED,   "/"},
 	MOD:          {BINARY,   "%"},
-	SMOD:         {BINARY,   "%"}, // signed
+	SMOD:         {SIGNED,   "%"},
 	ADDMOD:       {FUNCTION, "addmod"},
 	MULMOD:       {FUNCTION, "mulmod"},
 	EXP:          {BINARY,   "**"},
-	NOT:          {UNARY,    "!"},
+	SIGNEXTEND:   {EXTENSION, "int256"},
 	LT:           {BINARY,   "<"},
 	GT:           {BINARY,   ">"},
-	SLT:          {BINARY,   "<"}, // signed
-	SGT:          {BINARY,   ">"}, // signed
+	SLT:          {SIGNED,   "<"},
+	SGT:          {SIGNED,   ">"},
 	EQ:           {BINARY,   "=="},
-	ISZERO:       {BINARY,   "0 =="},
+	ISZERO:       {NEGATION, "!"},
 	AND:          {BINARY,   "&"},
 	OR:           {BINARY,   "|"},
 	XOR:          {BINARY,   "^"},
-	SHA3:         {FUNCTION, "sha3"},
-	ADDRESS:      {NULLARY,  "this"},
+	NOT:          {UNARY,    "~"},
+	BYTE:         {INDEX,    "bytes32"},
+	SHL:          {SHIFT,    "<<"},
+	SHR:          {SHIFT,    ">>"},
+	SAR:          {SIGNEDSHIFT, ">>"},
+	SHA3:         {HASH,     "keccak256"},
+	ADDRESS:      {NULLARY,  "address(this)"},
 	BALANCE:      {FIELD,    "balance"},
 	ORIGIN:       {NULLARY,  "tx.origin"},
 	CALLER:       {NULLARY,  "msg.sender"},
 	CALLVALUE:    {NULLARY,  "msg.value"},
-	CALLDATALOAD: {FUNCTION, "CALLDATALOAD"},
-	CALLDATASIZE: {FUNCTION, "CALLDATASIZE"},
-	CALLDATACOPY: {FUNCTION, "CALLDATACOPY"},
-	CODESIZE:     {FUNCTION, "CODESIZE"},
-	CODECOPY:     {FUNCTION, "CODECOPY"},
+	CALLDATALOAD: {CALLDATA, "msg.data"},
+	CALLDATASIZE: {NULLARY,  "msg.data.length"},
+	CALLDATACOPY: {FUNCTION, "calldatacopy"},
+	CODESIZE:     {NULLARY,  "address(this).code.length"},
+	CODECOPY:     {FUNCTION, "codecopy"},
 	GASPRICE:     {NULLARY,  "tx.gasprice"},
-	BLOCKHASH:    {FUNCTION, "block.blockhash"},
+	EXTCODESIZE:  {FIELD,    "code.length"},
+	EXTCODECOPY:  {FUNCTION, "extcodecopy"},
+	RETURNDATASIZE: {FUNCTION, "returndatasize"},
+	RETURNDATACOPY: {FUNCTION, "returndatacopy"},
+	EXTCODEHASH:  {FIELD,    "codehash"},
+	BLOCKHASH:    {FUNCTION, "blockhash"},
 	COINBASE:     {NULLARY,  "block.coinbase"},
 	TIMESTAMP:    {NULLARY,  "block.timestamp"},
 	NUMBER:       {NULLARY,  "block.number"},
 	DIFFICULTY:   {NULLARY,  "block.difficulty"},
 	GASLIMIT:     {NULLARY,  "block.gaslimit"},
-	EXTCODESIZE:  {FUNCTION, "EXTCODESIZE"},
-	EXTCODECOPY:  {FUNCTION, "EXTCODECOPY"},
-	MLOAD:        {FUNCTION, "MLOAD"},
-	MSTORE:       {FUNCTION, "MSTORE"},
-	MSTORE8:      {FUNCTION, "MSTORE8"},
-	SLOAD:        {FUNCTION, "SLOAD"},
-	SSTORE:       {FUNCTION, "SSTORE"},
-	PC:           {FUNCTION, "PC"},
-	MSIZE:        {FUNCTION, "MSIZE"},
-	GAS:          {NULLARY,  "msg.gas"},
-	LOG0:         {FUNCTION, "LOG0"},
-	LOG1:         {FUNCTION, "LOG1"},
-	LOG2:         {FUNCTION, "LOG2"},
-	LOG3:         {FUNCTION, "LOG3"},
-	LOG4:         {FUNCTION, "LOG4"},
-	CREATE:       {FUNCTION, "CREATE"},
-	CALL:         {FUNCTION, "CALL"},
-	RETURN:       {FUNCTION, "RETURN"},
-	CALLCODE:     {FUNCTION, "CALLCODE"},
-	DELEGATECALL: {FUNCTION, "DELEGATECALL"},
+	CHAINID:      {NULLARY,  "block.chainid"},
+	SELFBALANCE:  {NULLARY,  "address(this).balance"},
+	BASEFEE:      {NULLARY,  "block.basefee"},
+	BLOBHASH:     {FUNCTION, "blobhash"},
+	BLOBBASEFEE:  {NULLARY,  "block.blobbasefee"},
+	MLOAD:        {FUNCTION, "mload"},
+	MSTORE:       {FUNCTION, "mstore"},
+	MSTORE8:      {FUNCTION, "mstore8"},
+	SLOAD:        {FUNCTION, "sload"},
+	SSTORE:       {FUNCTION, "sstore"},
+	JUMP:         {FUNCTION, "jump"},
+	JUMPI:        {FUNCTION, "jumpi"},
+	MSIZE:        {FUNCTION, "msize"},
+	GAS:          {FUNCTION, "gasleft"},
+	TLOAD:        {FUNCTION, "tload"},
+	TSTORE:       {FUNCTION, "tstore"},
+	MCOPY:        {FUNCTION, "mcopy"},
+	LOG0:         {FUNCTION, "log0"},
+	LOG1:         {FUNCTION, "log1"},
+	LOG2:         {FUNCTION, "log2"},
+	LOG3:         {FUNCTION, "log3"},
+	LOG4:         {FUNCTION, "log4"},
+	CREATE:       {FUNCTION, "create"},
+	CALL:         {FUNCTION, "call"},
+	CALLCODE:     {FUNCTION, "callcode"},
+	RETURN:       {FUNCTION, "return"},
+	DELEGATECALL: {FUNCTION, "delegatecall"},
+	CREATE2:      {FUNCTION, "create2"},
+	STATICCALL:   {FUNCTION, "staticcall"},
+	REVERT:       {FUNCTION, "revert"},
+	INVALID:      {NULLARY,  "assert(false)"},
 	SELFDESTRUCT: {FUNCTION, "selfdestruct"},
 }
 
@@ -130,6 +208,25 @@ func (statement *Statement) Replace(from Expression, to Expression) {
 	}
 }
 
+func (phi *PhiNode) Replace(from Expression, to Expression) {
+	for i, input := range phi.Inputs {
+		if input == from {
+			phi.Inputs[i] = to
+		}
+	}
+}
+
+func (phi PhiNode) String() string {
+	str := fmt.Sprintf("var %v = φ(", phi.Output)
+	for i, input := range phi.Inputs {
+		if i > 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("%v: %v", phi.Blocks[i].Label, input)
+	}
+	return str + ");"
+}
+
 func (constant Constant) String() string {
 	return fmt.Sprintf("0x%X", constant.Value)
 }
@@ -138,41 +235,302 @@ func (variable Variable) String() string {
 	return variable.Label
 }
 
+// The type the output of the statement is declared with
+func (statement Statement) OutputType() string {
+	if value, ok := returnedValue(statement.Op, statement.Inputs); ok && value.Type != "" {
+		return value.Type + dataLocation(value.Type, "memory")
+	}
+	switch statement.Op {
+	case LT, GT, SLT, SGT, EQ, ISZERO, CALL, CALLCODE, DELEGATECALL, STATICCALL:
+		return "bool"
+	case ADDRESS, ORIGIN, CALLER, COINBASE, CREATE, CREATE2:
+		return "address"
+	case SHA3:
+		return "bytes32"
+	}
+	return "uint"
+}
+
 func (statement Statement) String() string {
 	str := ""
-	if statement.Output != nil {
-		str += fmt.Sprintf("var %v = ", statement.Output)
+	if call, ok := externalCall(statement.Op, statement.Inputs); ok && statement.Output != nil {
+		str += call.declaration(statement.Output)
+	} else if statement.Output != nil {
+		str += fmt.Sprintf("%v %v = ", statement.OutputType(), statement.Output)
 	}
-	
-	switch statement.Convention() {
+	rendered, _ := render(statement.Op, statement.Inputs)
+	return str + rendered + ";"
+}
+
+// Binding strength of the Solidity operators, higher binds tighter
+const (
+	atomPrecedence        = 100
+	unaryPrecedence       = 90
+	conditionalPrecedence = 10
+)
+
+var operatorPrecedence = map[string]int{
+	"**":   80,
+	"*":    70,
+	"/":    70,
+	"%":    70,
+	"+":    60,
+	"-":    60,
+	"<<":   55,
+	">>":   55,
+	"&":    50,
+	"^":    45,
+	"|":    40,
+	"<":    35,
+	">":    35,
+	"<=":   35,
+	">=":   35,
+	"==":   30,
+	"!=":   30,
+}
+
+func precedence(expression Expression) int {
+	operation, ok := expression.(*Operation)
+	if !ok {
+		return atomPrecedence
+	}
+	_, p := render(operation.Op, operation.Inputs)
+	return p
+}
+
+// Writes an operand, in parentheses if it binds weaker than required
+func operand(expression Expression, required int) string {
+	if precedence(expression) < required {
+		return fmt.Sprintf("(%v)", expression)
+	}
+	return fmt.Sprintf("%v", expression)
+}
+
+// Writes an operand of a signed operation as a signed value
+func signedOperand(expression Expression, required int) string {
+	switch expression := expression.(type) {
+	case Constant:
+		value := toSigned(expression.Value)
+		if value.Sign() >= 0 {
+			return expression.String()
+		}
+		str := fmt.Sprintf("-0x%X", new(big.Int).Neg(value))
+		if required > unaryPrecedence {
+			return "(" + str + ")"
+		}
+		return str
+	case *Cast:
+		if strings.HasPrefix(expression.Type, "int") {
+			return expression.String()
+		}
+	}
+	return fmt.Sprintf("int256(%v)", expression)
+}
+
+// Writes an operand that must be an address
+func addressOperand(expression Expression) string {
+	if cast, ok := expression.(*Cast); ok && cast.Type == "address" {
+		return cast.String()
+	}
+	return fmt.Sprintf("address(%v)", expression)
+}
+
+// Returns true if the expression is a comparison, with a value of zero
+// or one
+func isBoolean(expression Expression) bool {
+	switch expression := expression.(type) {
+	case *Operation:
+		switch expression.Op {
+		case LT, GT, SLT, SGT, EQ, ISZERO:
+			return true
+		}
+		if value, ok := returnedValue(expression.Op, expression.Inputs); ok {
+			return value.Type == "bool"
+		}
+	case *Cast:
+		return expression.Type == "bool"
+	}
+	return false
+}
+
+// The state variable a storage access is recovered as
+func storageOperand(op OpCode, inputs []Expression) (*StorageLocation, bool) {
+	if op != SLOAD && op != SSTORE {
+		return nil, false
+	}
+	location, ok := inputs[0].(*StorageLocation)
+	return location, ok
+}
+
+// Writes an operation on the inputs and returns the precedence of the
+// result
+func render(op OpCode, inputs []Expression) (string, int) {
+	info := opCodeInfo[op]
+	if event, ok := emittedEvent(op, inputs); ok {
+		return renderEmit(event, inputs[1:]), 0
+	}
+	if call, ok := externalCall(op, inputs); ok {
+		return renderCall(call, inputs[1:]), atomPrecedence
+	}
+	if value, ok := returnedValue(op, inputs); ok {
+		return value.Name, atomPrecedence
+	}
+	if location, ok := storageOperand(op, inputs); ok {
+		if op == SSTORE {
+			return fmt.Sprintf("%v = %v", location, inputs[1]), 0
+		}
+		return location.String(), atomPrecedence
+	}
+	switch info.Convention {
 	case NULLARY:
-		str += fmt.Sprintf("%v", statement.Solidity())
+		return info.Solidity, atomPrecedence
 	case UNARY:
-		str += fmt.Sprintf("%v %v", statement.Solidity(), statement.Inputs[0])
+		return info.Solidity + operand(inputs[0], unaryPrecedence), unaryPrecedence
 	case BINARY:
-		str += fmt.Sprintf("%v %v %v", statement.Inputs[0],
-			statement.Solidity(), statement.Inputs[1])
+		p := operatorPrecedence[info.Solidity]
+		if op == EXP {
+			// Exponentiation is right associative
+			return fmt.Sprintf("%v %v %v", operand(inputs[0], p + 1), info.Solidity,
+				operand(inputs[1], p)), p
+		}
+		return fmt.Sprintf("%v %v %v", operand(inputs[0], p), info.Solidity,
+			operand(inputs[1], p + 1)), p
+	case SIGNED:
+		p := operatorPrecedence[info.Solidity]
+		str := fmt.Sprintf("%v %v %v", signedOperand(inputs[0], p), info.Solidity,
+			signedOperand(inputs[1], p + 1))
+		
+		// Only comparisons are not signed values themselves
+		if op == SLT || op == SGT {
+			return str, p
+		}
+		return fmt.Sprintf("uint256(%v)", str), atomPrecedence
+	case SHIFT:
+		p := operatorPrecedence[info.Solidity]
+		return fmt.Sprintf("%v %v %v", operand(inputs[1], p), info.Solidity,
+			operand(inputs[0], p + 1)), p
+	case SIGNEDSHIFT:
+		p := operatorPrecedence[info.Solidity]
+		return fmt.Sprintf("uint256(%v %v %v)", signedOperand(inputs[1], p), info.Solidity,
+			operand(inputs[0], p + 1)), atomPrecedence
+	case NEGATION:
+		return negation(inputs[0])
 	case FIELD:
-		str += fmt.Sprintf("%v.%v", statement.Inputs[0], statement.Solidity())
-	case MEMBER, FUNCTION:
-		start := 0
-		if statement.Convention() == MEMBER {
-			str += fmt.Sprintf("%v.", statement.Inputs[0])
-			start = 1
-		}
-		str += fmt.Sprintf("%v(", statement.Solidity())
-		for i := start; i < len(statement.Inputs); i++ {
-			if i > start {
-				str += ", "
+		return fmt.Sprintf("%v.%v", addressOperand(inputs[0]), info.Solidity), atomPrecedence
+	case INDEX:
+		return byteIndex(inputs[0], inputs[1])
+	case CALLDATA:
+		return fmt.Sprintf("uint(bytes32(%v[%v:]))", info.Solidity, inputs[0]), atomPrecedence
+	case EXTENSION:
+		return signExtension(inputs[0], inputs[1])
+	case HASH:
+		// Buffers recovered from memory are a single input
+		if len(inputs) == 1 {
+			return fmt.Sprintf("%v(%v)", info.Solidity, inputs[0]), atomPrecedence
+		}
+		offset, ok1 := inputs[0].(Constant)
+		size, ok2 := inputs[1].(Constant)
+		if ok1 && ok2 {
+			end := Constant{Value: new(big.Int).Add(offset.Value, size.Value)}
+			return fmt.Sprintf("%v(memory[%v:%v])", info.Solidity, offset, end), atomPrecedence
+		}
+		p := operatorPrecedence["+"]
+		return fmt.Sprintf("%v(memory[%v:%v + %v])", info.Solidity, inputs[0], operand(inputs[0], p),
+			operand(inputs[1], p + 1)), atomPrecedence
+	}
+	str := ""
+	start := 0
+	if info.Convention == MEMBER {
+		str += fmt.Sprintf("%v.", operand(inputs[0], atomPrecedence))
+		start = 1
+	}
+	str += fmt.Sprintf("%v(", info.Solidity)
+	for i := start; i < len(inputs); i++ {
+		if i > start {
+			str += ", "
+		}
+		str += fmt.Sprintf("%v", inputs[i])
+	}
+	return str + ")", atomPrecedence
+}
+
+// Writes the sign extension of the value from the byte as a shift left
+// and back right of the value as signed. Bytes from 31 on leave the value
+// as it is.
+func signExtension(byte Expression, value Expression) (string, int) {
+	p := operatorPrecedence["<<"]
+	if constant, ok := byte.(Constant); ok {
+		if !constant.Value.IsInt64() || constant.Value.Int64() >= 31 {
+			return fmt.Sprintf("%v", value), precedence(value)
+		}
+		shift := Constant{Value: big.NewInt(248 - 8 * constant.Value.Int64())}
+		return fmt.Sprintf("uint256(int256(%v << %v) >> %v)", operand(value, p), shift, shift), atomPrecedence
+	}
+	shift := fmt.Sprintf("(0xF8 - 0x8 * %v)", operand(byte, operatorPrecedence["*"] + 1))
+	return fmt.Sprintf("%v < 0x1F ? uint256(int256(%v << %v) >> %v) : %v",
+		operand(byte, operatorPrecedence["<"]), operand(value, p), shift, shift,
+		operand(value, conditionalPrecedence + 1)), conditionalPrecedence
+}
+
+// Writes the byte of the value at the index and returns its precedence.
+// Solidity reverts on an index past the word, where the EVM returns zero.
+func byteIndex(index Expression, value Expression) (string, int) {
+	zero := Constant{Value: big.NewInt(0)}
+	byte := fmt.Sprintf("uint8(bytes32(%v)[%v])", value, index)
+	if constant, ok := index.(Constant); ok {
+		if !constant.Value.IsInt64() || constant.Value.Int64() >= 32 {
+			return zero.String(), atomPrecedence
+		}
+		return byte, atomPrecedence
+	}
+	return fmt.Sprintf("%v < 0x20 ? %v : %v", operand(index, operatorPrecedence["<"]), byte, zero),
+		conditionalPrecedence
+}
+
+// Writes the logical negation of the expression and returns its
+// precedence. Comparisons are inverted.
+func negation(expression Expression) (string, int) {
+	inverse := map[OpCode]string{LT: ">=", GT: "<=", SLT: ">=", SGT: "<=", EQ: "!="}
+	if operation, ok := expression.(*Operation); ok {
+		inputs := operation.Inputs
+		switch operation.Op {
+		case ISZERO:
+			if isBoolean(inputs[0]) {
+				return fmt.Sprintf("%v", inputs[0]), precedence(inputs[0])
 			}
-			str += fmt.Sprintf("%v", statement.Inputs[i])
+			p := operatorPrecedence["!="]
+			return fmt.Sprintf("%v != 0", operand(inputs[0], p)), p
+		case LT, GT, EQ:
+			p := operatorPrecedence[inverse[operation.Op]]
+			return fmt.Sprintf("%v %v %v", operand(inputs[0], p), inverse[operation.Op],
+				operand(inputs[1], p + 1)), p
+		case SLT, SGT:
+			p := operatorPrecedence[inverse[operation.Op]]
+			return fmt.Sprintf("%v %v %v", signedOperand(inputs[0], p), inverse[operation.Op],
+				signedOperand(inputs[1], p + 1)), p
 		}
-		str += ")"
 	}
-	str += ";"
+	if isBoolean(expression) {
+		return "!" + operand(expression, unaryPrecedence), unaryPrecedence
+	}
+	p := operatorPrecedence["=="]
+	return fmt.Sprintf("%v == 0", operand(expression, p)), p
+}
+
+func Negate(expression Expression) string {
+	str, _ := negation(expression)
 	return str
 }
 
+// Writes the expression as a condition, comparing values that are not
+// booleans to zero
+func Condition(expression Expression) string {
+	if isBoolean(expression) {
+		return fmt.Sprintf("%v", expression)
+	}
+	return fmt.Sprintf("%v != 0", operand(expression, operatorPrecedence["!="]))
+}
+
 type StatementBlock struct {
 	Offset          int
 	Statements      []*Statement
@@ -182,6 +540,9 @@ type StatementBlock struct {
 	Incoming        []*StatementBlock
 	CondBlocks      []*StatementBlock
 	NextBlock       *StatementBlock
+	JumpTargets     []*StatementBlock // Other targets of computed jumps
+	CondOutputs     [][]Expression    // The stack at each conditional jump
+	Phis            []*PhiNode
 }
 
 func (block StatementBlock) String() string {
@@ -196,6 +557,11 @@ func (block StatementBlock) String() string {
 		str += fmt.Sprintf("\tfrom %v\n", source.Label)
 	}
 	
+	// Phi nodes
+	for _, phi := range block.Phis {
+		str += fmt.Sprintf("\t%v\n", phi)
+	}
+	
 	// Statements
 	for _, statement := range block.Statements {
 		switch statement.Op {
@@ -203,12 +569,25 @@ func (block StatementBlock) String() string {
 		case JUMP:
 			if block.NextBlock != nil {
 				str += fmt.Sprintf("\tJUMP(%v)\n", block.NextBlock.Label)
+			} else if len(block.JumpTargets) > 0 {
+				str += "\tJUMP("
+				for i, target := range block.JumpTargets {
+					if i > 0 {
+						str += " | "
+					}
+					str += target.Label
+				}
+				str += ")\n"
 			} else {
 				str += fmt.Sprintf("\t%v\n", statement)
 			}
 		case JUMPI:
-			str += fmt.Sprintf("\tJUMPI %v %v\n", statement.Inputs[1],
-				block.CondBlocks[condCounter].Label)
+			if block.CondBlocks[condCounter] != nil {
+				str += fmt.Sprintf("\tJUMPI %v %v\n", statement.Inputs[1],
+					block.CondBlocks[condCounter].Label)
+			} else {
+				str += fmt.Sprintf("\t%v\n", statement)
+			}
 			condCounter++
 		default:
 			str += fmt.Sprintf("\t%v\n", statement)
@@ -227,24 +606,35 @@ func (block *StatementBlock) Replace(from Expression, to Expression) {
 	for _, statement := range block.Statements {
 		statement.Replace(from, to)
 	}
-	newOutputs := make([]Expression, 0)
-	for _, output := range block.Outputs {
-		if output == from {
-			output = to
+	for _, phi := range block.Phis {
+		phi.Replace(from, to)
+	}
+	block.Outputs = replaceExpression(block.Outputs, from, to)
+	for i, outputs := range block.CondOutputs {
+		block.CondOutputs[i] = replaceExpression(outputs, from, to)
+	}
+}
+
+func replaceExpression(list []Expression, from Expression, to Expression) []Expression {
+	newList := make([]Expression, 0)
+	for _, expression := range list {
+		if expression == from {
+			expression = to
 		}
-		newOutputs = append(newOutputs, output)
+		newList = append(newList, expression)
 	}
-	block.Outputs = newOutputs
+	return newList
 }
 
+// A block that only pushes values falls through to the next
 func (block *StatementBlock) CanGoToNext() bool {
 	n := len(block.Statements)
 	if n == 0 {
-		return false
+		return true
 	}
 	last := block.Statements[n - 1]
 	switch last.Op {
-	case JUMP, RETURN, SELFDESTRUCT, STOP:
+	case JUMP, RETURN, REVERT, INVALID, SELFDESTRUCT, STOP:
 		return false
 	default:
 		return true
@@ -253,6 +643,17 @@ func (block *StatementBlock) CanGoToNext() bool {
 
 type SSAProgram struct {
 	Blocks          []*StatementBlock
+	JumpDests       *JumpDestAnalysis
+	ErrorBlock      *StatementBlock
+	Functions       []*InternalFunction
+	Calls           map[*StatementBlock]*CallSite
+	CFG             *CFG
+	PublicFunctions []*PublicFunction
+	StateVariables  []*StateVariable
+	Events          []*Event
+	Interfaces      []*Interface
+	Signatures      *SignatureDatabase // Resolves the selectors of public functions
+	Fork            Fork               // Instruction set of the program
 }
 
 func (ssa SSAProgram) PrintSSA() {
@@ -264,7 +665,7 @@ func (ssa SSAProgram) PrintSSA() {
 // A counter for generating unique identifiers
 var ssaCount int
 
-func CompileSSABlock(block *BasicBlock) *StatementBlock {
+func CompileSSABlock(block *BasicBlock, fork Fork) *StatementBlock {
 	
 	// Create the StatementBlock
 	statements := &StatementBlock{
@@ -295,6 +696,12 @@ func CompileSSABlock(block *BasicBlock) *StatementBlock {
 	for _, instruction := range block.Instructions {
 		
 		// Stack management
+		if instruction.Op == PUSH0 {
+			stack.Push(Constant{
+				Value: big.NewInt(0),
+			})
+			continue
+		}
 		if instruction.Op.IsPush() {
 			stack.Push(Constant{
 				Value: instruction.Arg,
@@ -314,6 +721,22 @@ func CompileSSABlock(block *BasicBlock) *StatementBlock {
 			continue
 		}
 		
+		// The program counter is known, neither Solidity nor strict
+		// assembly can read it
+		if instruction.Op == PC {
+			stack.Push(Constant{
+				Value: big.NewInt(int64(instruction.Offset)),
+			})
+			continue
+		}
+		
+		// From Paris on DIFFICULTY reads the randomness of the beacon
+		// chain, which has a name of its own
+		if instruction.Op == DIFFICULTY && fork >= Paris {
+			stack.Push(&Randomness{})
+			continue
+		}
+		
 		// Create a new statement
 		statement := &Statement{
 			Op:       instruction.Op,
@@ -339,6 +762,12 @@ func CompileSSABlock(block *BasicBlock) *StatementBlock {
 			stack.Push(variable)
 			statement.Output = &variable
 		}
+		
+		// Conditional jumps can leave the block before its end
+		if instruction.Op == JUMPI {
+			stackCopy := append([]Expression{}, stack.Values...)
+			statements.CondOutputs = append(statements.CondOutputs, stackCopy)
+		}
 	}
 	
 	// Check if the stack is empty at the end of the StatementBlock
@@ -350,12 +779,14 @@ func CompileSSABlock(block *BasicBlock) *StatementBlock {
 func CompileSSA(program *Program) *SSAProgram {
 	ssaCount = 0
 	ssaProgram := &SSAProgram{
-		Blocks: make([]*StatementBlock, 0),
+		Blocks:    make([]*StatementBlock, 0),
+		JumpDests: program.JumpDests,
+		Fork:      program.Fork,
 	}
 	
 	// Add compile assembly blocks to SSA
 	for _, block := range program.Blocks {
-		ssaProgram.Blocks = append(ssaProgram.Blocks, CompileSSABlock(block))
+		ssaProgram.Blocks = append(ssaProgram.Blocks, CompileSSABlock(block, program.Fork))
 		n := len(ssaProgram.Blocks) - 1
 		
 		// Under certain condition the blocks can continue to the next
@@ -365,8 +796,9 @@ func CompileSSA(program *Program) *SSAProgram {
 	}
 	
 	// Add fake error block at offset 2. This is the default
-	// jump target for errors in solidity
-	ssaProgram.Blocks = append(ssaProgram.Blocks, &StatementBlock{
+	// jump target for errors in solidity. All jumps to invalid
+	// destinations end up here.
+	ssaProgram.ErrorBlock = &StatementBlock{
 		Offset:     2,
 		Label:      "ErrorTag",
 		Statements: make([]*Statement, 0),
@@ -375,7 +807,8 @@ func CompileSSA(program *Program) *SSAProgram {
 		Incoming:   make([]*StatementBlock, 0),
 		CondBlocks: make([]*StatementBlock, 0),
 		NextBlock:  nil,
-	})
+	}
+	ssaProgram.Blocks = append(ssaProgram.Blocks, ssaProgram.ErrorBlock)
 	
 	return ssaProgram
 }
@@ -393,6 +826,7 @@ func (ssa *SSAProgram) UpdateJumpTargets(block *StatementBlock) {
 	
 	// Clear existing
 	block.CondBlocks = make([]*StatementBlock, 0)
+	block.JumpTargets = make([]*StatementBlock, 0)
 	
 	// All statements
 	for _, statement := range block.Statements {
@@ -402,19 +836,38 @@ func (ssa *SSAProgram) UpdateJumpTargets(block *StatementBlock) {
 			continue
 		}
 		
-		// Filter fixed JUMPS
-		constant, ok:= statement.Inputs[0].(Constant)
-		if !ok {
-			continue
+		// Fixed JUMPS and computed JUMPS with resolved targets
+		targets := statement.Targets
+		if constant, ok := statement.Inputs[0].(Constant); ok {
+			targets = []int{-1}
+			if constant.Value.IsInt64() {
+				targets[0] = int(constant.Value.Int64())
+			}
 		}
-		target := int(constant.Value.Int64())
 		
-		// Find the target block
-		targetBlock := ssa.BlockByOffset(target)
-		if statement.Op == JUMPI {
-			block.CondBlocks = append(block.CondBlocks, targetBlock)
-		} else {
-			block.NextBlock = targetBlock
+		// Find the target blocks. Jumping to an invalid destination
+		// is an exceptional halt.
+		targetBlocks := make([]*StatementBlock, 0)
+		for _, target := range targets {
+			targetBlock := ssa.ErrorBlock
+			if ssa.JumpDests.IsValid(target) {
+				targetBlock = ssa.BlockByOffset(target)
+			}
+			if targetBlock != nil {
+				targetBlocks = append(targetBlocks, targetBlock)
+			}
+		}
+		
+		switch {
+		case statement.Op == JUMPI && len(targetBlocks) == 0:
+			block.CondBlocks = append(block.CondBlocks, nil)
+		case statement.Op == JUMPI:
+			block.CondBlocks = append(block.CondBlocks, targetBlocks[0])
+			block.JumpTargets = append(block.JumpTargets, targetBlocks[1:]...)
+		case len(targetBlocks) == 1:
+			block.NextBlock = targetBlocks[0]
+		default:
+			block.JumpTargets = append(block.JumpTargets, targetBlocks...)
 		}
 	}
 }
@@ -425,23 +878,90 @@ func (ssa *SSAProgram) ComputeJumpTargets() {
 	}
 }
 
+// Builds the control flow graph from the jump targets of all blocks
+// and updates the incoming blocks
 func (ssa *SSAProgram) ComputeIncoming() {
+	if len(ssa.Blocks) == 0 {
+		ssa.CFG = NewCFG(nil)
+		return
+	}
+	ssa.CFG = NewCFG(ssa.Blocks[0])
 	for _, block := range ssa.Blocks {
-		block.Incoming = make([]*StatementBlock, 0)
-		for _, source := range ssa.Blocks {
-			isTarget := false
-			if source.NextBlock == block {
-				isTarget = true
-			}
-			for _, sourceCond := range source.CondBlocks {
-				if sourceCond == block {
-					isTarget = true
-				}
-			}
-			if isTarget {
-				block.Incoming = append(block.Incoming, source)
-			}
+		ssa.CFG.AddNode(block)
+	}
+	for _, block := range ssa.Blocks {
+		ssa.addEdges(block)
+	}
+	for _, block := range ssa.Blocks {
+		ssa.updateIncoming(block)
+	}
+}
+
+// Replaces the outgoing edges of the block after its jump targets
+// changed and updates the incoming blocks of the old and new targets
+func (ssa *SSAProgram) UpdateEdges(block *StatementBlock) {
+	if ssa.CFG == nil {
+		ssa.ComputeIncoming()
+		return
+	}
+	old := ssa.CFG.SuccessorNodes(block)
+	ssa.CFG.ClearSuccessors(block)
+	ssa.addEdges(block)
+	for _, node := range old {
+		ssa.updateIncoming(node.(*StatementBlock))
+	}
+	for _, node := range ssa.CFG.SuccessorNodes(block) {
+		ssa.updateIncoming(node.(*StatementBlock))
+	}
+}
+
+func (ssa *SSAProgram) addEdges(block *StatementBlock) {
+	n := len(block.Statements)
+	var last OpCode = STOP
+	if n > 0 {
+		last = block.Statements[n - 1].Op
+	}
+	_, call := ssa.Calls[block]
+	
+	for _, target := range block.CondBlocks {
+		if target == ssa.ErrorBlock {
+			ssa.CFG.AddEdge(block, target, ExceptionalEdge)
+		} else if target != nil {
+			ssa.CFG.AddEdge(block, target, TrueEdge)
+		}
+	}
+	if block.NextBlock != nil {
+		kind := FallthroughEdge
+		switch {
+		case block.NextBlock == ssa.ErrorBlock:
+			kind = ExceptionalEdge
+		case call:
+			kind = CallEdge
+		case last == JUMP:
+			kind = JumpEdge
+		case last == JUMPI:
+			kind = FalseEdge
 		}
+		ssa.CFG.AddEdge(block, block.NextBlock, kind)
+	}
+	for _, target := range block.JumpTargets {
+		kind := JumpEdge
+		switch {
+		case target == ssa.ErrorBlock:
+			kind = ExceptionalEdge
+		case ssa.isFunctionReturn(block):
+			kind = ReturnEdge
+		case last == JUMPI:
+			kind = TrueEdge
+		}
+		ssa.CFG.AddEdge(block, target, kind)
+	}
+}
+
+func (ssa *SSAProgram) updateIncoming(block *StatementBlock) {
+	block.Incoming = make([]*StatementBlock, 0)
+	for _, node := range ssa.CFG.PredecessorNodes(block) {
+		block.Incoming = append(block.Incoming, node.(*StatementBlock))
 	}
 }
 
@@ -467,6 +987,9 @@ func (ssa *SSAProgram) MergeBlocks(first *StatementBlock, second *StatementBlock
 		extra := first.Outputs[:out - in]
 		Prefix(&second.Inputs, extra)
 		Prefix(&second.Outputs, extra)
+		for i := range second.CondOutputs {
+			Prefix(&second.CondOutputs[i], extra)
+		}
 		in = out
 	}
 	if in > out {
@@ -475,6 +998,9 @@ func (ssa *SSAProgram) MergeBlocks(first *StatementBlock, second *StatementBlock
 		extra := second.Inputs[:in - out]
 		Prefix(&first.Inputs, extra)
 		Prefix(&first.Outputs, extra)
+		for i := range first.CondOutputs {
+			Prefix(&first.CondOutputs[i], extra)
+		}
 		out = in
 	}
 	
@@ -485,6 +1011,7 @@ func (ssa *SSAProgram) MergeBlocks(first *StatementBlock, second *StatementBlock
 	
 	// Seconds outputs are the merged blocks outputs
 	first.Outputs = second.Outputs
+	first.CondOutputs = append(first.CondOutputs, second.CondOutputs...)
 	
 	// TODO: Remove uncoditional JUMP statement?
 	
@@ -505,10 +1032,18 @@ func (ssa *SSAProgram) MergeBlocks(first *StatementBlock, second *StatementBlock
 	}
 	ssa.Blocks = newBlocks
 	
-	// Rewire the connections and re-analyse the control flow
+	// Rewire the connections and update the control flow graph
+	if ssa.CFG == nil {
+		ssa.ComputeIncoming()
+	}
+	successors := ssa.CFG.SuccessorNodes(second)
+	ssa.CFG.RemoveNode(second)
+	for _, node := range successors {
+		ssa.updateIncoming(node.(*StatementBlock))
+	}
 	first.NextBlock = second.NextBlock
 	ssa.UpdateJumpTargets(first)
-	ssa.ComputeIncoming()
+	ssa.UpdateEdges(first)
 }
 
 func (ssa *SSAProgram) TryCollapseOneJump() bool {
@@ -522,17 +1057,29 @@ func (ssa *SSAProgram) TryCollapseOneJump() bool {
 	//        jump targets may be computed, we can never do this
 	//        perfectly.
 	
+	continuations := ssa.continuations()
 	for _, block := range ssa.Blocks {
 		if len(block.Incoming) != 1 {
 			continue
 		}
 		
+		// The source may also jump to the block conditionally
+		if ssa.CFG != nil && len(ssa.CFG.Predecessors(block)) != 1 {
+			continue
+		}
+		
 		// We want to be next, not the target of a conditional jump
 		source := block.Incoming[0]
 		if source.NextBlock != block {
 			continue
 		}
 		
+		// Calls and returns stay apart, even from a function with a single
+		// call site, so RecoverFunctions finds them
+		if source.isReturn() || ssa.returnAddress(source, continuations) >= 0 {
+			continue
+		}
+		
 		// If the last statement of source is a JUMP, we can drop it
 		n := len(source.Statements)
 		if  n > 0  && source.Statements[n - 1].Op == JUMP {
@@ -0,0 +1,206 @@
+package evmdis
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func variables(n int) []Expression {
+	inputs := make([]Expression, n)
+	for i := range inputs {
+		inputs[i] = Variable{Label: string(rune('a' + i))}
+	}
+	return inputs
+}
+
+func operation(op OpCode, inputs ...Expression) *Operation {
+	return &Operation{Op: op, Inputs: inputs}
+}
+
+func TestRenderOpCodes(t *testing.T) {
+	tests := map[OpCode]string{
+		STOP:           "return",
+		ADD:            "a + b",
+		MUL:            "a * b",
+		SUB:            "a - b",
+		DIV:            "a / b",
+		SDIV:           "uint256(int256(a) / int256(b))",
+		MOD:            "a % b",
+		SMOD:           "uint256(int256(a) % int256(b))",
+		ADDMOD:         "addmod(a, b, c)",
+		MULMOD:         "mulmod(a, b, c)",
+		EXP:            "a ** b",
+		SIGNEXTEND:     "a < 0x1F ? uint256(int256(b << (0xF8 - 0x8 * a)) >> (0xF8 - 0x8 * a)) : b",
+		LT:             "a < b",
+		GT:             "a > b",
+		SLT:            "int256(a) < int256(b)",
+		SGT:            "int256(a) > int256(b)",
+		EQ:             "a == b",
+		ISZERO:         "a == 0",
+		AND:            "a & b",
+		OR:             "a | b",
+		XOR:            "a ^ b",
+		NOT:            "~a",
+		BYTE:           "a < 0x20 ? uint8(bytes32(b)[a]) : 0x0",
+		SHL:            "b << a",
+		SHR:            "b >> a",
+		SAR:            "uint256(int256(b) >> a)",
+		SHA3:           "keccak256(memory[a:a + b])",
+		ADDRESS:        "address(this)",
+		BALANCE:        "address(a).balance",
+		ORIGIN:         "tx.origin",
+		CALLER:         "msg.sender",
+		CALLVALUE:      "msg.value",
+		CALLDATALOAD:   "uint(bytes32(msg.data[a:]))",
+		CALLDATASIZE:   "msg.data.length",
+		CALLDATACOPY:   "calldatacopy(a, b, c)",
+		CODESIZE:       "address(this).code.length",
+		CODECOPY:       "codecopy(a, b, c)",
+		GASPRICE:       "tx.gasprice",
+		EXTCODESIZE:    "address(a).code.length",
+		EXTCODECOPY:    "extcodecopy(a, b, c, d)",
+		RETURNDATASIZE: "returndatasize()",
+		RETURNDATACOPY: "returndatacopy(a, b, c)",
+		EXTCODEHASH:    "address(a).codehash",
+		BLOCKHASH:      "blockhash(a)",
+		COINBASE:       "block.coinbase",
+		TIMESTAMP:      "block.timestamp",
+		NUMBER:         "block.number",
+		DIFFICULTY:     "block.difficulty",
+		GASLIMIT:       "block.gaslimit",
+		CHAINID:        "block.chainid",
+		SELFBALANCE:    "address(this).balance",
+		BASEFEE:        "block.basefee",
+		BLOBHASH:       "blobhash(a)",
+		BLOBBASEFEE:    "block.blobbasefee",
+		MLOAD:          "mload(a)",
+		MSTORE:         "mstore(a, b)",
+		MSTORE8:        "mstore8(a, b)",
+		SLOAD:          "sload(a)",
+		SSTORE:         "sstore(a, b)",
+		JUMP:           "jump(a)",
+		JUMPI:          "jumpi(a, b)",
+		MSIZE:          "msize()",
+		GAS:            "gasleft()",
+		TLOAD:          "tload(a)",
+		TSTORE:         "tstore(a, b)",
+		MCOPY:          "mcopy(a, b, c)",
+		LOG0:           "log0(a, b)",
+		LOG1:           "log1(a, b, c)",
+		LOG2:           "log2(a, b, c, d)",
+		LOG3:           "log3(a, b, c, d, e)",
+		LOG4:           "log4(a, b, c, d, e, f)",
+		CREATE:         "create(a, b, c)",
+		CALL:           "call(a, b, c, d, e, f, g)",
+		CALLCODE:       "callcode(a, b, c, d, e, f, g)",
+		RETURN:         "return(a, b)",
+		DELEGATECALL:   "delegatecall(a, b, c, d, e, f)",
+		CREATE2:        "create2(a, b, c, d)",
+		STATICCALL:     "staticcall(a, b, c, d, e, f)",
+		REVERT:         "revert(a, b)",
+		INVALID:        "assert(false)",
+		SELFDESTRUCT:   "selfdestruct(a)",
+	}
+	for op := range opCodeInfo {
+		if _, ok := tests[op]; !ok {
+			t.Errorf("%v has no render test", op)
+		}
+	}
+	for op, expected := range tests {
+		str, _ := render(op, variables(op.StackReads()))
+		if str != expected {
+			t.Errorf("%v: expected %q, got %q", op, expected, str)
+		}
+	}
+}
+
+func TestRenderExpressions(t *testing.T) {
+	a, b, c := Variable{Label: "a"}, Variable{Label: "b"}, Variable{Label: "c"}
+	constant := func(value int64) Constant {
+		return Constant{Value: big.NewInt(value)}
+	}
+	minusOne := Constant{Value: new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))}
+	tests := []struct {
+		name       string
+		expression *Operation
+		expected   string
+	}{
+		{"not of sum", operation(NOT, operation(ADD, a, b)), "~(a + b)"},
+		{"iszero of comparison", operation(ISZERO, operation(LT, a, b)), "a >= b"},
+		{"iszero of value", operation(ISZERO, operation(ADD, a, b)), "a + b == 0"},
+		{"signed negative", operation(SLT, a, minusOne), "int256(a) < -0x1"},
+		{"signed division nested", operation(SDIV, operation(ADD, a, b), c), "uint256(int256(a + b) / int256(c))"},
+		{"signed division in sum", operation(ADD, operation(SDIV, a, b), c), "uint256(int256(a) / int256(b)) + c"},
+		{"arithmetic shift", operation(SAR, constant(8), operation(ADD, a, b)), "uint256(int256(a + b) >> 0x8)"},
+		{"shift of sum", operation(SHL, a, operation(ADD, b, c)), "b + c << a"},
+		{"sign extension byte 0", operation(SIGNEXTEND, constant(0), a), "uint256(int256(a << 0xF8) >> 0xF8)"},
+		{"sign extension byte 15", operation(SIGNEXTEND, constant(15), a), "uint256(int256(a << 0x80) >> 0x80)"},
+		{"sign extension byte 31", operation(SIGNEXTEND, constant(31), a), "a"},
+		{"sign extension in sum", operation(ADD, operation(SIGNEXTEND, b, a), c),
+			"(b < 0x1F ? uint256(int256(a << (0xF8 - 0x8 * b)) >> (0xF8 - 0x8 * b)) : a) + c"},
+		{"byte of sum", operation(BYTE, constant(31), operation(ADD, a, b)), "uint8(bytes32(a + b)[0x1F])"},
+		{"byte past the word", operation(BYTE, constant(32), a), "0x0"},
+		{"byte in sum", operation(ADD, operation(BYTE, a, b), c), "(a < 0x20 ? uint8(bytes32(b)[a]) : 0x0) + c"},
+		{"hash of constant range", operation(SHA3, constant(0), constant(64)), "keccak256(memory[0x0:0x40])"},
+		{"hash of sum", operation(SHA3, a, operation(ADD, b, c)), "keccak256(memory[a:a + (b + c)])"},
+		{"exponent right associative", operation(EXP, a, operation(EXP, b, c)), "a ** b ** c"},
+		{"exponent of exponent", operation(EXP, operation(EXP, a, b), c), "(a ** b) ** c"},
+		{"exponent binds tighter than product", operation(MUL, a, operation(EXP, b, c)), "a * b ** c"},
+		{"exponent of product", operation(EXP, operation(MUL, a, b), c), "(a * b) ** c"},
+		{"exponent of negation", operation(EXP, operation(NOT, a), b), "~a ** b"},
+	}
+	for _, test := range tests {
+		if str := test.expression.String(); str != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.name, test.expected, str)
+		}
+	}
+}
+
+func TestStatementDeclaration(t *testing.T) {
+	tests := []struct {
+		op       OpCode
+		expected string
+	}{
+		{LT, "bool x = a < b;"},
+		{CALLER, "address x = msg.sender;"},
+		{SHA3, "bytes32 x = keccak256(memory[a:a + b]);"},
+		{ADD, "uint x = a + b;"},
+		{SDIV, "uint x = uint256(int256(a) / int256(b));"},
+		{SMOD, "uint x = uint256(int256(a) % int256(b));"},
+		{SAR, "uint x = uint256(int256(b) >> a);"},
+		{SLT, "bool x = int256(a) < int256(b);"},
+		{BYTE, "uint x = a < 0x20 ? uint8(bytes32(b)[a]) : 0x0;"},
+	}
+	for _, test := range tests {
+		statement := Statement{
+			Op:     test.op,
+			Inputs: variables(test.op.StackReads()),
+			Output: &Variable{Label: "x"},
+		}
+		if str := statement.String(); str != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.op, test.expected, str)
+		}
+	}
+}
+
+func TestRenderDifficulty(t *testing.T) {
+	// s[0] = block.difficulty
+	code, _ := hex.DecodeString("4460005500")
+	tests := map[Fork]string{
+		London: "block.difficulty",
+		Paris:  "sstore(0x0, block.prevrandao)",
+		Cancun: "sstore(0x0, block.prevrandao)",
+	}
+	for fork, expected := range tests {
+		ssa := CompileSSA(NewProgram(code, fork))
+		str := ""
+		for _, statement := range ssa.Blocks[0].Statements {
+			str += statement.String() + "\n"
+		}
+		if !strings.Contains(str, expected) {
+			t.Errorf("%v: expected %q, got\n%v", fork, expected, str)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package evmdis
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// A state variable of the contract, the storage slot it starts at and
+// how it is accessed
+type StateVariable struct {
+	Slot            *big.Int
+	Offset          int      // Bytes below a field packed into the slot
+	Name            string
+	Keys            []string // Key types of mappings, empty for array indices
+	Type            string   // The type of the values
+}
+
+// The declared type: mappings from the keys and arrays of the values
+func (variable *StateVariable) Declaration() string {
+	declaration := variable.Type
+	for i := len(variable.Keys) - 1; i >= 0; i-- {
+		if variable.Keys[i] == "" {
+			declaration += "[]"
+		} else {
+			declaration = fmt.Sprintf("mapping(%v => %v)", variable.Keys[i], declaration)
+		}
+	}
+	return declaration
+}
+
+// A storage key recovered as an access of a state variable, through the
+// keys of mappings and indices of arrays, or the length of an array
+type StorageLocation struct {
+	Expression
+	Variable        *StateVariable
+	Keys            []Expression
+	Length          bool
+}
+
+func (location *StorageLocation) String() string {
+	str := location.Variable.Name
+	for _, key := range location.Keys {
+		str += fmt.Sprintf("[%v]", key)
+	}
+	if location.Length {
+		str += ".length"
+	}
+	return str
+}
+
+// A storage key as a slot and the accesses applied to it. Mapping keys
+// are hashed with the slot, arrays hash the slot and add the index.
+type storagePath struct {
+	Slot            *big.Int
+	Keys            []Expression
+	Mappings        []bool // Whether each key is a mapping key or an index
+	Statements      []*Statement // The hashes and additions computing the key
+}
+
+// A field packed into the word of a slot, read with a shift and a mask or
+// written by merging it with the rest of the word
+type packedAccess struct {
+	Statement       *Statement
+	Input           int // The input read, -1 for the value written
+	Slot            *big.Int
+	Offset          int
+	Type            string
+	Value           Expression
+}
+
+type storageAnalysis struct {
+	ssa             *SSAProgram
+	memory          *memoryAnalysis
+	types           *typeInference
+	paths           map[*Statement]*storagePath
+	accesses        []*Statement              // Statements with a path, in block order
+	packed          []*packedAccess
+	variables       map[string]*StateVariable // By slot and offset
+}
+
+func variableKey(slot *big.Int, offset int) string {
+	return fmt.Sprintf("%x/%v", slot, offset)
+}
+
+// The statement computing the value, nil for other expressions
+func (s *storageAnalysis) definition(expression Expression) *Statement {
+	return s.memory.definition(expression)
+}
+
+// The words stored in memory before a hash, relative to its input
+func (s *storageAnalysis) hashed(hash *Statement) (map[int64]*memoryWord, bool) {
+	block, i := s.memory.position(hash)
+	start, ok := s.memory.address(hash.Inputs[0])
+	if block == nil || !ok {
+		return nil, false
+	}
+	return s.memory.words(block, i, start), true
+}
+
+// The type of a mapping key
+func (s *storageAnalysis) keyType(key Expression) string {
+	if cast, ok := key.(*Cast); ok {
+		return cast.Type
+	}
+	if statement := s.definition(key); statement != nil {
+		switch statement.Op {
+		case CALLER, ORIGIN, ADDRESS, COINBASE:
+			return "address"
+		}
+	}
+	return s.types.argumentType(key)
+}
+
+// The slot or the accesses computing the storage key. Hashes of a key and
+// a slot are mapping accesses, hashes of a slot plus an index are array
+// elements.
+func (s *storageAnalysis) path(key Expression) (*storagePath, bool) {
+	if constant, ok := key.(Constant); ok {
+		return &storagePath{Slot: constant.Value}, true
+	}
+	var index Expression = Constant{Value: big.NewInt(0)}
+	var addition *Statement
+	statement := s.definition(key)
+	if statement != nil && statement.Op == ADD {
+		for i := 0; i < 2; i++ {
+			if hash := s.definition(statement.Inputs[i]); hash != nil && hash.Op == SHA3 {
+				addition, statement, index = statement, hash, statement.Inputs[1 - i]
+				break
+			}
+		}
+	}
+	if statement == nil || statement.Op != SHA3 {
+		return nil, false
+	}
+	
+	// Find the hashed words
+	words, ok := s.hashed(statement)
+	size, sized := statement.Inputs[1].(Constant)
+	if !ok || !sized {
+		return nil, false
+	}
+	
+	var path *storagePath
+	switch {
+	case size.Value.Cmp(big.NewInt(0x40)) == 0 && words[0] != nil && words[0x20] != nil:
+		if path, ok = s.path(words[0x20].Value); !ok {
+			return nil, false
+		}
+		path.Keys = append(path.Keys, words[0].Value)
+		path.Mappings = append(path.Mappings, true)
+		if !isConstant(index, 0) {
+			return nil, false
+		}
+	case size.Value.Cmp(big.NewInt(0x20)) == 0 && words[0] != nil:
+		if path, ok = s.path(words[0].Value); !ok {
+			return nil, false
+		}
+		path.Keys = append(path.Keys, index)
+		path.Mappings = append(path.Mappings, false)
+	default:
+		return nil, false
+	}
+	path.Statements = append(path.Statements, statement)
+	if addition != nil {
+		path.Statements = append(path.Statements, addition)
+	}
+	return path, true
+}
+
+// Recognizes a packed field read from a loaded word: a mask of the word
+// shifted right by whole bytes
+func (s *storageAnalysis) packedRead(cast *Cast, loads map[string]*big.Int) (*big.Int, int, bool) {
+	value, shift := cast.Value, 0
+	if statement := s.definition(value); statement != nil {
+		switch {
+		case statement.Op == DIV:
+			if divisor, ok := statement.Inputs[1].(Constant); ok {
+				bits := divisor.Value.BitLen() - 1
+				if bits > 0 && bits % 8 == 0 && divisor.Value.Cmp(new(big.Int).Lsh(big.NewInt(1), uint(bits))) == 0 {
+					value, shift = statement.Inputs[0], bits
+				}
+			}
+		case statement.Op == SHR:
+			if amount, ok := statement.Inputs[0].(Constant); ok && amount.Value.IsInt64() && amount.Value.Int64() % 8 == 0 {
+				value, shift = statement.Inputs[1], int(amount.Value.Int64())
+			}
+		}
+	}
+	label, ok := variableLabel(value)
+	if !ok || loads[label] == nil {
+		return nil, 0, false
+	}
+	return loads[label], shift / 8, true
+}
+
+// Recognizes a packed field written into a loaded word: the word with the
+// field cleared, combined with the value shifted left by whole bytes
+func (s *storageAnalysis) packedWrite(statement *Statement, loads map[string]*big.Int) (*packedAccess, bool) {
+	slot, ok := statement.Inputs[0].(Constant)
+	merge := s.definition(statement.Inputs[1])
+	if !ok || merge == nil || merge.Op != OR {
+		return nil, false
+	}
+	for i := 0; i < 2; i++ {
+		clear := s.definition(merge.Inputs[i])
+		if clear == nil || clear.Op != AND {
+			continue
+		}
+		for j := 0; j < 2; j++ {
+			label, ok := variableLabel(clear.Inputs[j])
+			mask, isMask := clear.Inputs[1 - j].(Constant)
+			if !ok || !isMask || loads[label] == nil || loads[label].Cmp(slot.Value) != 0 {
+				continue
+			}
+			
+			// The cleared bits are the field
+			field := new(big.Int).Xor(mask.Value, lowMask(256))
+			offset := int(field.TrailingZeroBits())
+			bits, ok := maskBits(new(big.Int).Rsh(field, uint(offset)))
+			if !ok || offset % 8 != 0 || field.Sign() == 0 {
+				continue
+			}
+			value := merge.Inputs[1 - i]
+			if offset > 0 {
+				shifted := s.definition(value)
+				if shifted == nil {
+					continue
+				}
+				factor := Constant{Value: new(big.Int).Lsh(big.NewInt(1), uint(offset))}
+				switch {
+				case shifted.Op == MUL && expressionKey(shifted.Inputs[0]) == expressionKey(factor):
+					value = shifted.Inputs[1]
+				case shifted.Op == MUL && expressionKey(shifted.Inputs[1]) == expressionKey(factor):
+					value = shifted.Inputs[0]
+				case shifted.Op == SHL && isConstant(shifted.Inputs[0], int64(offset)):
+					value = shifted.Inputs[1]
+				default:
+					continue
+				}
+			}
+			fieldType := maskType(bits)
+			if cast, ok := value.(*Cast); ok {
+				fieldType = cast.Type
+			}
+			return &packedAccess{
+				Statement: statement,
+				Input:     -1,
+				Slot:      slot.Value,
+				Offset:    offset / 8,
+				Type:      fieldType,
+				Value:     value,
+			}, true
+		}
+	}
+	return nil, false
+}
+
+// Finds the packed fields. Loads are only followed within their block
+// until storage may change.
+func (s *storageAnalysis) findPacked() {
+	for _, block := range s.ssa.Blocks {
+		loads := make(map[string]*big.Int)
+		for _, statement := range block.Statements {
+			for i, input := range statement.Inputs {
+				if cast, ok := input.(*Cast); ok {
+					if slot, offset, ok := s.packedRead(cast, loads); ok {
+						s.packed = append(s.packed, &packedAccess{
+							Statement: statement,
+							Input:     i,
+							Slot:      slot,
+							Offset:    offset,
+							Type:      cast.Type,
+						})
+					}
+				}
+			}
+			if statement.Op == SSTORE {
+				if access, ok := s.packedWrite(statement, loads); ok {
+					s.packed = append(s.packed, access)
+				}
+			}
+			if statement.Op.writes() & storageEffect != 0 {
+				loads = make(map[string]*big.Int)
+			}
+			if statement.Op != SLOAD {
+				continue
+			}
+			if slot, ok := statement.Inputs[0].(Constant); ok {
+				loads[statement.Output.Label] = slot.Value
+			}
+		}
+	}
+}
+
+// The type of the values stored at or loaded from a location
+func (s *storageAnalysis) valueType(statement *Statement) string {
+	if statement.Op == SSTORE {
+		if cast, ok := statement.Inputs[1].(*Cast); ok {
+			return cast.Type
+		}
+		return ""
+	}
+	if casts := s.types.casts[statement.Output.Label]; len(casts) > 0 {
+		return casts[0]
+	}
+	return ""
+}
+
+func (s *storageAnalysis) variable(slot *big.Int, offset int) *StateVariable {
+	key := variableKey(slot, offset)
+	if variable, ok := s.variables[key]; ok {
+		return variable
+	}
+	variable := &StateVariable{
+		Slot:   slot,
+		Offset: offset,
+		Name:   fmt.Sprintf("var_%x", slot),
+		Keys:   make([]string, 0),
+	}
+	if offset > 0 {
+		variable.Name += fmt.Sprintf("_%v", offset)
+	}
+	s.variables[key] = variable
+	return variable
+}
+
+// Classifies the storage keys of all loads and stores and names the state
+// variables they access after their slots. Mappings, arrays and fields
+// packed into a slot are declared with their types. Must run after
+// Simplify, which turns masks into casts.
+func (ssa *SSAProgram) RecoverStorage() {
+	s := &storageAnalysis{
+		ssa:       ssa,
+		memory:    ssa.memoryAnalysis(),
+		types:     ssa.typeInference(),
+		paths:     make(map[*Statement]*storagePath),
+		packed:    make([]*packedAccess, 0),
+		variables: make(map[string]*StateVariable),
+	}
+	for _, block := range ssa.Blocks {
+		for _, statement := range block.Statements {
+			if statement.Op != SLOAD && statement.Op != SSTORE {
+				continue
+			}
+			if path, ok := s.path(statement.Inputs[0]); ok {
+				s.paths[statement] = path
+				s.accesses = append(s.accesses, statement)
+			}
+		}
+	}
+	s.findPacked()
+	
+	// Slots with fields above the lowest byte are packed, their fields
+	// are separate variables
+	packed := make(map[string]bool)
+	for _, access := range s.packed {
+		if access.Offset > 0 {
+			packed[access.Slot.String()] = true
+		}
+	}
+	for _, access := range s.packed {
+		if !packed[access.Slot.String()] {
+			continue
+		}
+		variable := s.variable(access.Slot, access.Offset)
+		if variable.Type == "" {
+			variable.Type = access.Type
+		}
+		location := &StorageLocation{Variable: variable, Keys: make([]Expression, 0)}
+		if access.Input < 0 {
+			access.Statement.Inputs = []Expression{location, access.Value}
+		} else {
+			access.Statement.Inputs[access.Input] = &Operation{
+				Op:     SLOAD,
+				Inputs: []Expression{location},
+			}
+		}
+	}
+	
+	// The variable of a slot is accessed with the most keys, accesses
+	// with fewer keys read the length of an array
+	for _, statement := range s.accesses {
+		path := s.paths[statement]
+		if packed[path.Slot.String()] {
+			continue
+		}
+		variable := s.variable(path.Slot, 0)
+		if len(path.Keys) > len(variable.Keys) {
+			variable.Keys = make([]string, len(path.Keys))
+			for i, key := range path.Keys {
+				if path.Mappings[i] {
+					variable.Keys[i] = s.keyType(key)
+				}
+			}
+		}
+		if valueType := s.valueType(statement); valueType != "" && len(path.Keys) == len(variable.Keys) {
+			variable.Type = valueType
+		}
+	}
+	statements := make([]*Statement, 0)
+	for _, statement := range s.accesses {
+		path := s.paths[statement]
+		if packed[path.Slot.String()] {
+			continue
+		}
+		variable := s.variable(path.Slot, 0)
+		location := &StorageLocation{Variable: variable, Keys: path.Keys}
+		if len(path.Keys) < len(variable.Keys) {
+			if len(path.Keys) > 0 || variable.Keys[0] != "" {
+				continue
+			}
+			location.Length = true
+		}
+		statement.Inputs[0] = location
+		statements = append(statements, path.Statements...)
+	}
+	
+	ssa.StateVariables = make([]*StateVariable, 0, len(s.variables))
+	for _, variable := range s.variables {
+		if variable.Type == "" {
+			variable.Type = "uint256"
+		}
+		ssa.StateVariables = append(ssa.StateVariables, variable)
+	}
+	sort.Slice(ssa.StateVariables, func(i, j int) bool {
+		a, b := ssa.StateVariables[i], ssa.StateVariables[j]
+		if c := a.Slot.Cmp(b.Slot); c != 0 {
+			return c < 0
+		}
+		return a.Offset < b.Offset
+	})
+	s.removeKeys(statements)
+}
+
+// Removes the computations of storage keys that are no longer used, and
+// the stores of the words hashed, until no more are unused
+func (s *storageAnalysis) removeKeys(statements []*Statement) {
+	for changed := true; changed; {
+		uses := s.ssa.uses()
+		removed := make(map[*Statement]bool)
+		for _, statement := range statements {
+			if s.memory.blocks[statement] != nil && uses[statement.Output.Label] == 0 {
+				removed[statement] = true
+			}
+		}
+		stores := make(map[*Statement]bool)
+		for statement := range removed {
+			if statement.Op != SHA3 {
+				continue
+			}
+			words, _ := s.hashed(statement)
+			size := statement.Inputs[1].(Constant).Value.Int64()
+			for offset, word := range words {
+				block, i := s.memory.position(word.Store)
+				if word.Local && offset >= 0 && offset < size && s.memory.onlyReadBy(block, i, removed) {
+					stores[word.Store] = true
+				}
+			}
+		}
+		for statement := range stores {
+			removed[statement] = true
+		}
+		changed = s.memory.remove(removed) > 0
+	}
+}
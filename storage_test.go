@@ -0,0 +1,29 @@
+package evmdis
+
+import (
+	"testing"
+)
+
+func TestRecoverStorageDeterministic(t *testing.T) {
+	// s[0] = uint8(msg.data[4]); s[0] = address(msg.data[0x24]);
+	// s[1][msg.sender] = 1; s[1] = 2
+	code := dispatcher + "60043560ff16600055" +
+		"60243573ffffffffffffffffffffffffffffffffffffffff16600055" +
+		"33600052600160205260016040600020556002600155" + "00"
+	var expected string
+	for i := 0; i < 20; i++ {
+		ssa := recoverContract(t, code)
+		types := ""
+		for _, variable := range ssa.StateVariables {
+			types += variable.Declaration() + ";"
+		}
+		if i == 0 {
+			expected = types
+		} else if types != expected {
+			t.Fatalf("expected %v, got %v", expected, types)
+		}
+	}
+	if expected != "address;mapping(address => uint256);" {
+		t.Errorf("expected the type of the last store, got %v", expected)
+	}
+}
@@ -0,0 +1,636 @@
+package evmdis
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// A loop being written. Jumps to the header continue the loop, jumps to
+// the follow block break out of it.
+type loopContext struct {
+	Loop            *Loop
+	Header          *StatementBlock
+	Follow          *StatementBlock
+	Latch           *StatementBlock // Conditional back edge of a do-while loop
+	Condition       Expression      // Loop condition of a do-while loop
+	Rest            int             // Statement in the latch after the condition
+	Update          string          // Assignments of the back edge of a for loop
+}
+
+// Writes the blocks of a function as nested if/else and while statements
+type structurer struct {
+	ssa             *SSAProgram
+	function        *InternalFunction // Nil for public functions
+	cfg             *CFG
+	postdominators  *DominatorTree
+	joins           *DominatorTree           // Post-dominators of the paths that do not end the function
+	loops           map[Node]*Loop
+	active          map[*StatementBlock]bool // Blocks on the path being written
+	written         map[*StatementBlock]bool // Blocks written so far
+	failed          bool                     // Structuring needs a goto or a second copy of a block
+	contexts        []*loopContext
+	hoisted         map[*Statement]bool      // Moved into the update of a for loop
+	uses            map[string]int
+}
+
+// The control flow graph of a single function. Calls continue with the
+// block the function returns to, returns end the function.
+func (ssa *SSAProgram) functionCFG(entry *StatementBlock) *CFG {
+	if ssa.CFG == nil {
+		ssa.ComputeIncoming()
+	}
+	cfg := NewCFG(entry)
+	work := []*StatementBlock{entry}
+	for len(work) > 0 {
+		block := work[len(work) - 1]
+		work = work[:len(work) - 1]
+		edges := make([]*Edge, 0)
+		if call, ok := ssa.Calls[block]; ok {
+			edges = append(edges, &Edge{block, call.Continuation, JumpEdge})
+		} else if !ssa.isFunctionReturn(block) {
+			edges = ssa.CFG.Successors(block)
+		}
+		for _, edge := range edges {
+			if !cfg.HasNode(edge.To) {
+				work = append(work, edge.To.(*StatementBlock))
+			}
+			cfg.AddEdge(block, edge.To, edge.Kind)
+		}
+	}
+	return cfg
+}
+
+// The graph without the edges into blocks that end the function, in which
+// the paths that continue join again
+func (cfg *CFG) withoutEnds() *CFG {
+	result := NewCFG(cfg.Entry)
+	for _, node := range cfg.Nodes {
+		result.AddNode(node)
+		for _, edge := range cfg.successors[node] {
+			if len(cfg.successors[edge.To]) > 0 {
+				result.AddEdge(edge.From, edge.To, edge.Kind)
+			}
+		}
+	}
+	return result
+}
+
+// Writes the body of the function starting at the entry block, recovering
+// if/else, loops, break and continue from the control flow. A function
+// with a cycle other than a loop, or with code that would be written once
+// for every path reaching it, is written as a loop over its blocks.
+func (ssa *SSAProgram) Structure(entry *StatementBlock, function *InternalFunction) string {
+	return ssa.StructureFrom(entry, 0, function)
+}
+
+// Writes the body of a function that starts at a statement in the middle
+// of the entry block
+func (ssa *SSAProgram) StructureFrom(entry *StatementBlock, start int, function *InternalFunction) string {
+	s := &structurer{
+		ssa:      ssa,
+		function: function,
+		cfg:      ssa.functionCFG(entry),
+		loops:    make(map[Node]*Loop),
+		active:   make(map[*StatementBlock]bool),
+		written:  make(map[*StatementBlock]bool),
+		hoisted:  make(map[*Statement]bool),
+	}
+	s.postdominators = s.cfg.PostDominators()
+	s.joins = s.cfg.withoutEnds().PostDominators()
+	for _, loop := range s.cfg.Loops(s.cfg.Dominators()) {
+		s.loops[loop.Header] = loop
+	}
+	
+	var body string
+	if start > 0 {
+		s.active[entry] = true
+		body, _ = s.block(entry, start, nil, "\t\t")
+	} else {
+		body, _ = s.enter(entry, nil, "\t\t")
+	}
+	if s.failed {
+		s.hoisted = make(map[*Statement]bool)
+		body = s.dispatch(entry, start)
+	}
+	
+	// Declare the variables assigned on the edges into phi nodes
+	str := ""
+	for _, node := range s.cfg.Nodes {
+		for _, phi := range node.(*StatementBlock).Phis {
+			str += fmt.Sprintf("\t\tuint %v;\n", phi.Output)
+		}
+	}
+	return str + body
+}
+
+func (s *structurer) context() *loopContext {
+	if len(s.contexts) == 0 {
+		return nil
+	}
+	return s.contexts[len(s.contexts) - 1]
+}
+
+// Continues at a block, either by breaking out of or continuing the
+// current loop, or by writing the block. Only blocks that end the function
+// may be written on more than one path. Returns true if control does not
+// reach the stop block.
+func (s *structurer) enter(block *StatementBlock, stop *StatementBlock, indent string) (string, bool) {
+	if s.failed {
+		return "", true
+	}
+	if block == s.ssa.ErrorBlock {
+		return indent + "revert();\n", true
+	}
+	if context := s.context(); context != nil {
+		if block == context.Header && context.Latch == nil {
+			return indent + "continue;\n", true
+		}
+		if block == context.Follow {
+			return indent + "break;\n", true
+		}
+	}
+	if block == stop {
+		return "", false
+	}
+	
+	// A cycle that is not a loop, or a block reached again after its paths
+	// have joined, would need a goto
+	if s.active[block] || (s.written[block] && len(s.cfg.Successors(block)) > 0) {
+		s.failed = true
+		return "", true
+	}
+	s.active[block] = true
+	s.written[block] = true
+	defer delete(s.active, block)
+	if loop, ok := s.loops[block]; ok {
+		return s.loop(loop, stop, indent)
+	}
+	return s.block(block, 0, stop, indent)
+}
+
+// Follows an edge, assigning the values the phi nodes of the target
+// select for it. The update of a for loop assigns them on its back edge.
+func (s *structurer) move(from *StatementBlock, to *StatementBlock, stop *StatementBlock, indent string) (string, bool) {
+	str := s.assignments(from, to, indent)
+	if context := s.context(); context != nil && to == context.Header && context.Update != "" {
+		str = ""
+	}
+	rest, terminates := s.enter(to, stop, indent)
+	return str + rest, terminates
+}
+
+// The assignments to the phi nodes of the target on an edge
+func (s *structurer) assignments(from *StatementBlock, to *StatementBlock, indent string) string {
+	str := ""
+	for _, phi := range to.Phis {
+		for i, source := range phi.Blocks {
+			if source == from && expressionKey(phi.Inputs[i]) != phi.Output.Label {
+				str += fmt.Sprintf("%v%v = %v;\n", indent, phi.Output, phi.Inputs[i])
+			}
+		}
+	}
+	return str
+}
+
+// The nearest block all targets lead to, ignoring the targets that end the
+// function if ends is false
+func (s *structurer) join(tree *DominatorTree, targets []*StatementBlock, ends bool) (*StatementBlock, bool) {
+	var join Node
+	for _, target := range targets {
+		if target == nil || target == s.ssa.ErrorBlock || (!ends && len(s.cfg.Successors(target)) == 0) {
+			continue
+		}
+		if join == nil {
+			join = target
+		} else {
+			join = tree.NearestCommonDominator(join, target)
+		}
+		if join == nil {
+			return nil, false
+		}
+	}
+	block, ok := join.(*StatementBlock)
+	return block, ok
+}
+
+// The block where the branches of a conditional jump join again, nil if
+// they only join outside the current loop. The jump may be followed by
+// more statements, so all later exits of the block are taken into
+// account. Branches that end the function on some paths join the others
+// where the paths that continue meet.
+func (s *structurer) follow(block *StatementBlock, condition int) *StatementBlock {
+	targets := make([]*StatementBlock, 0)
+	for _, target := range block.CondBlocks[condition:] {
+		targets = append(targets, target)
+	}
+	if call, ok := s.ssa.Calls[block]; ok {
+		targets = append(targets, call.Continuation)
+	} else {
+		targets = append(targets, block.NextBlock)
+		targets = append(targets, block.JumpTargets...)
+	}
+	follow, ok := s.join(s.postdominators, targets, true)
+	if !ok {
+		follow, ok = s.join(s.joins, targets, false)
+	}
+	if !ok {
+		return nil
+	}
+	if context := s.context(); context != nil {
+		if follow == context.Header || !context.Loop.Contains(follow) {
+			return nil
+		}
+	}
+	return follow
+}
+
+// Writes the statements of the block from the given index on and the
+// blocks that follow it up to the stop block
+func (s *structurer) block(block *StatementBlock, start int, stop *StatementBlock, indent string) (string, bool) {
+	str := ""
+	condition := 0
+	for _, statement := range block.Statements[:start] {
+		if statement.Op == JUMPI {
+			condition++
+		}
+	}
+	
+	n := len(block.Statements)
+	for i := start; i < n; i++ {
+		statement := block.Statements[i]
+		last := i == n - 1
+		switch {
+		case statement.Op == JUMPDEST || s.hoisted[statement]:
+		case statement.Op == JUMPI:
+			var target *StatementBlock
+			if condition < len(block.CondBlocks) {
+				target = block.CondBlocks[condition]
+			}
+			jump := condition
+			condition++
+			
+			// The end of a do-while loop
+			if context := s.context(); context != nil &&
+				block == context.Latch && target == context.Header {
+				context.Condition = statement.Inputs[1]
+				context.Rest = i + 1
+				return str, true
+			}
+			
+			switch target {
+			case nil:
+				str += fmt.Sprintf("%v%v\n", indent, statement)
+				continue
+			case s.ssa.ErrorBlock:
+				str += fmt.Sprintf("%vif (%v) revert();\n", indent, Condition(statement.Inputs[1]))
+				continue
+			}
+			
+			// Branches that end on their own need no else
+			follow := s.follow(block, jump)
+			then, thenTerminates := s.move(block, target, follow, indent + "\t")
+			if thenTerminates {
+				str += fmt.Sprintf("%vif (%v) {\n%v%v}\n", indent, Condition(statement.Inputs[1]), then, indent)
+				continue
+			}
+			var otherwise string
+			var elseTerminates bool
+			if last {
+				otherwise, elseTerminates = s.next(block, follow, indent + "\t")
+			} else {
+				otherwise, elseTerminates = s.block(block, i + 1, follow, indent + "\t")
+			}
+			switch {
+			case then == "":
+				str += fmt.Sprintf("%vif (%v) {\n%v%v}\n", indent, Negate(statement.Inputs[1]), otherwise, indent)
+			case otherwise == "":
+				str += fmt.Sprintf("%vif (%v) {\n%v%v}\n", indent, Condition(statement.Inputs[1]), then, indent)
+			default:
+				str += fmt.Sprintf("%vif (%v) {\n%v%v} else {\n%v%v}\n", indent, Condition(statement.Inputs[1]),
+					then, indent, otherwise, indent)
+			}
+			if follow == nil {
+				return str, elseTerminates
+			}
+			rest, terminates := s.enter(follow, stop, indent)
+			return str + rest, terminates
+		case statement.Op == JUMP && last:
+			str += s.jump(block, statement, indent)
+		default:
+			str += fmt.Sprintf("%v%v\n", indent, statement)
+		}
+	}
+	rest, terminates := s.next(block, stop, indent)
+	return str + rest, terminates
+}
+
+// Writes the jump at the end of the block as a call, a return, or as is
+// if its target is not known
+func (s *structurer) jump(block *StatementBlock, statement *Statement, indent string) string {
+	if call, ok := s.ssa.Calls[block]; ok {
+		return fmt.Sprintf("%v%v\n", indent, call)
+	}
+	if s.function != nil && block.isReturn() {
+		return indent + s.function.returnStatement(block) + "\n"
+	}
+	if block.NextBlock == nil {
+		return fmt.Sprintf("%v%v\n", indent, statement)
+	}
+	return ""
+}
+
+// Writes the function as a loop over its blocks, each written once. The
+// variable state holds the offset of the block to run next.
+func (s *structurer) dispatch(entry *StatementBlock, start int) string {
+	indent := "\t\t\t\t"
+	str := fmt.Sprintf("\t\tuint state = %v;\n\t\twhile (true) {\n", blockOffset(entry))
+	for _, node := range s.cfg.Nodes {
+		block := node.(*StatementBlock)
+		if block == s.ssa.ErrorBlock {
+			continue
+		}
+		first := 0
+		if block == entry {
+			first = start
+		}
+		condition := 0
+		for _, statement := range block.Statements[:first] {
+			if statement.Op == JUMPI {
+				condition++
+			}
+		}
+		str += fmt.Sprintf("\t\t\tif (state == %v) {\n", blockOffset(block))
+		n := len(block.Statements)
+		for i := first; i < n; i++ {
+			statement := block.Statements[i]
+			switch {
+			case statement.Op == JUMPDEST:
+			case statement.Op == JUMPI:
+				var target *StatementBlock
+				if condition < len(block.CondBlocks) {
+					target = block.CondBlocks[condition]
+				}
+				condition++
+				if target == nil {
+					str += fmt.Sprintf("%v%v\n", indent, statement)
+					continue
+				}
+				str += fmt.Sprintf("%vif (%v) {\n%v%v}\n", indent, Condition(statement.Inputs[1]),
+					s.transfer(block, target, indent + "\t"), indent)
+			case statement.Op == JUMP && i == n - 1:
+				str += s.jump(block, statement, indent)
+			default:
+				str += fmt.Sprintf("%v%v\n", indent, statement)
+			}
+		}
+		if call, ok := s.ssa.Calls[block]; ok {
+			str += s.transfer(block, call.Continuation, indent)
+		} else if block.NextBlock != nil && (s.function == nil || !block.isReturn()) {
+			str += s.transfer(block, block.NextBlock, indent)
+		}
+		str += "\t\t\t}\n"
+	}
+	return str + "\t\t}\n"
+}
+
+func blockOffset(block *StatementBlock) Constant {
+	return Constant{Value: big.NewInt(int64(block.Offset))}
+}
+
+// Continues at another block of a function written as a loop over its
+// blocks
+func (s *structurer) transfer(from *StatementBlock, to *StatementBlock, indent string) string {
+	if to == s.ssa.ErrorBlock {
+		return indent + "revert();\n"
+	}
+	return fmt.Sprintf("%v%vstate = %v;\n%vcontinue;\n", s.assignments(from, to, indent), indent,
+		blockOffset(to), indent)
+}
+
+// Continues after the last statement of the block
+func (s *structurer) next(block *StatementBlock, stop *StatementBlock, indent string) (string, bool) {
+	if call, ok := s.ssa.Calls[block]; ok {
+		return s.move(block, call.Continuation, stop, indent)
+	}
+	if block.NextBlock == nil || (s.function != nil && block.isReturn()) {
+		return "", true
+	}
+	return s.move(block, block.NextBlock, stop, indent)
+}
+
+// Writes a loop and continues with the block after it
+func (s *structurer) loop(loop *Loop, stop *StatementBlock, indent string) (string, bool) {
+	header := loop.Header.(*StatementBlock)
+	context := &loopContext{
+		Loop:   loop,
+		Header: header,
+	}
+	for _, edge := range loop.Exits {
+		if edge.To != s.ssa.ErrorBlock {
+			context.Follow = edge.To.(*StatementBlock)
+			break
+		}
+	}
+	
+	// A single conditional back edge is the condition of a do-while
+	// loop. The loop continues with the rest of the block after the
+	// condition.
+	if len(loop.BackEdges) == 1 && loop.BackEdges[0].Kind == TrueEdge && len(header.Phis) == 0 {
+		latch := loop.BackEdges[0].From.(*StatementBlock)
+		jumps := 0
+		for _, target := range latch.CondBlocks {
+			if target == header {
+				jumps++
+			}
+		}
+		if jumps == 1 && (latch.NextBlock == nil || len(latch.NextBlock.Phis) == 0) {
+			context.Latch = latch
+			context.Follow = nil
+			if n := len(latch.Statements); latch.Statements[n - 1].Op == JUMPI {
+				context.Follow = latch.NextBlock
+			}
+		}
+	}
+	
+	// A header that begins with a test whether to leave the loop gives
+	// the condition of a while loop, or of a for loop if the back edge
+	// only updates the variables of the header
+	var first *StatementBlock
+	var condition string
+	start := 0
+	if context.Latch == nil {
+		if test, body, rest, exit := s.pretest(loop, header); body != nil {
+			condition, first, start = test, body, rest
+			context.Follow = exit
+			context.Update = s.update(loop, header)
+		}
+	}
+	
+	str := ""
+	s.contexts = append(s.contexts, context)
+	var body string
+	switch {
+	case first != nil:
+		if first == header {
+			body, _ = s.block(header, start, nil, indent + "\t")
+		} else {
+			body, _ = s.move(header, first, nil, indent + "\t")
+		}
+	default:
+		body, _ = s.block(header, 0, nil, indent + "\t")
+	}
+	s.contexts = s.contexts[:len(s.contexts) - 1]
+	
+	// Continuing at the end of the loop body is implicit
+	body = strings.TrimSuffix(body, indent + "\tcontinue;\n")
+	
+	switch {
+	case context.Latch != nil && context.Condition != nil:
+		str += fmt.Sprintf("%vdo {\n%v%v} while (%v);\n", indent, body, indent, Condition(context.Condition))
+		rest, terminates := s.block(context.Latch, context.Rest, stop, indent)
+		return str + rest, terminates
+	case context.Update != "":
+		str += fmt.Sprintf("%vfor (; %v; %v) {\n%v%v}\n", indent, condition, context.Update, body, indent)
+	case first != nil:
+		str += fmt.Sprintf("%vwhile (%v) {\n%v%v}\n", indent, condition, body, indent)
+	default:
+		str += fmt.Sprintf("%vwhile (true) {\n%v%v}\n", indent, body, indent)
+	}
+	if context.Follow == nil {
+		return str, true
+	}
+	rest, terminates := s.enter(context.Follow, stop, indent)
+	return str + rest, terminates
+}
+
+// Returns the condition to stay in the loop, where the body starts and
+// the block after the loop if the header begins with a test whether to
+// leave the loop. The body continues with the rest of the header, or with
+// the block the header jumps to. The body is nil if there is no test.
+func (s *structurer) pretest(loop *Loop, header *StatementBlock) (string, *StatementBlock, int, *StatementBlock) {
+	if _, ok := s.ssa.Calls[header]; ok || len(header.CondBlocks) == 0 {
+		return "", nil, 0, nil
+	}
+	i := 0
+	for i < len(header.Statements) && header.Statements[i].Op == JUMPDEST {
+		i++
+	}
+	if i == len(header.Statements) || header.Statements[i].Op != JUMPI {
+		return "", nil, 0, nil
+	}
+	
+	// Values assigned when leaving from the header would be assigned on
+	// every break as well
+	test := header.Statements[i].Inputs[1]
+	target, last := header.CondBlocks[0], i == len(header.Statements) - 1
+	var condition string
+	var body, exit *StatementBlock
+	start := 0
+	switch {
+	case !loop.Contains(target) && !last:
+		condition, body, start, exit = Negate(test), header, i + 1, target
+	case !loop.Contains(target) && header.NextBlock != nil && loop.Contains(header.NextBlock):
+		condition, body, exit = Negate(test), header.NextBlock, target
+	case last && target != header && header.NextBlock != nil && !loop.Contains(header.NextBlock):
+		condition, body, exit = Condition(test), target, header.NextBlock
+	default:
+		return "", nil, 0, nil
+	}
+	if exit == s.ssa.ErrorBlock || s.assignments(header, exit, "") != "" {
+		return "", nil, 0, nil
+	}
+	return condition, body, start, exit
+}
+
+// The assignments of the single back edge of a pre-tested loop, written
+// as the update of a for loop. A value computed in the latch from the
+// variables of the header alone moves into the update. Returns an empty
+// string if the back edge needs anything else.
+func (s *structurer) update(loop *Loop, header *StatementBlock) string {
+	if len(loop.BackEdges) != 1 {
+		return ""
+	}
+	latch := loop.BackEdges[0].From.(*StatementBlock)
+	if s.uses == nil {
+		s.uses = s.ssa.uses()
+	}
+	targets := make([]string, 0)
+	values := make([]string, 0)
+	hoisted := make([]*Statement, 0)
+	for _, phi := range header.Phis {
+		for i, source := range phi.Blocks {
+			value := phi.Inputs[i]
+			if source != latch || expressionKey(value) == phi.Output.Label {
+				continue
+			}
+			if variable, ok := value.(Variable); ok && !header.isPhi(variable) {
+				definition := latch.definition(variable)
+				if definition == nil || s.uses[variable.Label] != 1 {
+					return ""
+				}
+				value = &Operation{
+					Op:     definition.Op,
+					Inputs: definition.Inputs,
+				}
+				hoisted = append(hoisted, definition)
+			}
+			if !header.headerOnly(value) {
+				return ""
+			}
+			targets = append(targets, phi.Output.String())
+			values = append(values, fmt.Sprintf("%v", value))
+		}
+	}
+	for _, statement := range hoisted {
+		s.hoisted[statement] = true
+	}
+	switch len(targets) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("%v = %v", targets[0], values[0])
+	}
+	return fmt.Sprintf("(%v) = (%v)", strings.Join(targets, ", "), strings.Join(values, ", "))
+}
+
+func (block *StatementBlock) isPhi(variable Variable) bool {
+	for _, phi := range block.Phis {
+		if phi.Output.Label == variable.Label {
+			return true
+		}
+	}
+	return false
+}
+
+// The statement of the block assigning the variable, nil if there is none
+func (block *StatementBlock) definition(variable Variable) *Statement {
+	for _, statement := range block.Statements {
+		if statement.Output != nil && statement.Output.Label == variable.Label {
+			return statement
+		}
+	}
+	return nil
+}
+
+// Returns true if the expression computes its value from constants and
+// the variables of the header alone, without reading any state
+func (block *StatementBlock) headerOnly(expression Expression) bool {
+	switch expression := expression.(type) {
+	case Constant:
+		return true
+	case Variable:
+		return block.isPhi(expression)
+	case *Operation:
+		if !expression.Op.isMovable() || expression.Op.reads() != 0 {
+			return false
+		}
+		for _, input := range expression.Inputs {
+			if !block.headerOnly(input) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
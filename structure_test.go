@@ -0,0 +1,122 @@
+package evmdis
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Runs the passes of the decompiler on runtime code and writes the
+// contract
+func decompile(t *testing.T, code string) string {
+	return recoverContract(t, code).Contract()
+}
+
+// Runs the passes of the decompiler on runtime code
+func recoverContract(t *testing.T, code string) *SSAProgram {
+	bytecode, err := hex.DecodeString(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssa := CompileSSA(NewProgram(bytecode, LatestFork))
+	ssa.ComputeJumpTargets()
+	ssa.ComputeIncoming()
+	ssa.ResolveJumps()
+	ssa.CollapseJumps()
+	ssa.RecoverFunctions()
+	ssa.ConstructSSA()
+	ssa.Signatures = NewSignatureDatabase()
+	ssa.LabelFunctions()
+	ssa.Simplify()
+	ssa.DecodeReturns()
+	ssa.RecoverStorage()
+	ssa.RecoverEvents()
+	ssa.RecoverMemory()
+	ssa.RecoverCalls()
+	ssa.InferArgumentTypes()
+	ssa.EliminateDeadCode()
+	ssa.FoldExpressions()
+	return ssa
+}
+
+func TestStructureLoops(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		loop    string
+	}{
+		// for (i = 0; i < n; i++) if (i & 1) x = i; else s[i] += i;
+		{"for", "60003560005b8181101561002d578060011661002057808054018155610025565b806000555b600101610005565b00",
+			`for \(; (a\d+) < x\d+; (a\d+) = 0x1 \+ (a\d+)\) \{`},
+		// The same loop continuing with i = s[i] instead
+		{"while", "60003560005b8181101561002b578060011661002057808054018155610025565b806000555b54610005565b00",
+			`while \((a\d+) < x\d+\) \{`},
+		// do { } while (x != 0);
+		{"do-while", "34" + "5b600054600157" + "00",
+			`do \{\s*\} while \(var_0 != 0\);`},
+	}
+	for _, test := range tests {
+		contract := decompile(t, test.code)
+		if !regexp.MustCompile(test.loop).MatchString(contract) {
+			t.Errorf("%v: expected %v in\n%v", test.name, test.loop, contract)
+		}
+		if regexp.MustCompile(`while \(true\)|break;`).MatchString(contract) {
+			t.Errorf("%v: expected no endless loop in\n%v", test.name, contract)
+		}
+	}
+}
+
+func TestStructureInvalidJump(t *testing.T) {
+	// if (msg.value) jumps to 0x0, which is no JUMPDEST
+	contract := decompile(t, "34600057" + "00")
+	if !regexp.MustCompile(`if \(msg.value != 0\) revert\(\);`).MatchString(contract) {
+		t.Errorf("expected a revert in\n%v", contract)
+	}
+}
+
+// A chain of stages, each storing to one of two slots or stopping. Every
+// stage joins the next, which is written once whatever the path to it.
+func diamonds(n int) string {
+	code := ""
+	for i := 0; i < n; i++ {
+		offset := 36 * i
+		code += fmt.Sprintf("5b60%02x3561%04x5760%02x60%02x5561%04x56", 2 * i, offset + 17, i, i, offset + 36)
+		code += fmt.Sprintf("5b60%02x3561%04x5760%02x60%02x5561%04x56", 2 * i + 1, offset + 34, i, i + 0x80, offset + 36)
+		code += "5b00"
+	}
+	return code + "5b00"
+}
+
+func TestStructureDiamonds(t *testing.T) {
+	short, long := decompile(t, diamonds(4)), decompile(t, diamonds(8))
+	if len(long) > 3 * len(short) {
+		t.Errorf("expected the contract to grow linearly, got %v bytes for 4 stages and %v for 8", len(short),
+			len(long))
+	}
+	for i := 0; i < 8; i++ {
+		for _, store := range []string{fmt.Sprintf("var_%v = 0x%v;", i, i), fmt.Sprintf("var_8%v = 0x%v;", i, i)} {
+			if n := strings.Count(long, store); n != 1 {
+				t.Errorf("expected %v once, got it %v times in\n%v", store, n, long)
+			}
+		}
+	}
+}
+
+func TestStructureIrreducible(t *testing.T) {
+	// The cycle between the stores to slots 1 and 2 is entered at either,
+	// it is left after the store to slot 1
+	contract := decompile(t, "600035610018575b600160015560013561002257610018565b6002600255610007565b00")
+	if strings.Contains(contract, "goto") {
+		t.Errorf("expected no goto in\n%v", contract)
+	}
+	for _, store := range []string{"var_1 = 0x1;", "var_2 = 0x2;"} {
+		if n := strings.Count(contract, store); n != 1 {
+			t.Errorf("expected %v once, got it %v times in\n%v", store, n, contract)
+		}
+	}
+	if !strings.Contains(contract, "while (true) {") {
+		t.Errorf("expected a loop over the blocks in\n%v", contract)
+	}
+}
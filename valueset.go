@@ -0,0 +1,301 @@
+package evmdis
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// The possible constant values of an expression. A nil set means the
+// value is unknown.
+type ValueSet map[string]*big.Int
+
+// Sets that grow beyond this size are considered unknown
+const MaxValueSetSize = 32
+
+func NewValueSet(values ...*big.Int) ValueSet {
+	set := make(ValueSet)
+	for _, value := range values {
+		set[value.Text(16)] = value
+	}
+	return set
+}
+
+func (set ValueSet) String() string {
+	if set == nil {
+		return "?"
+	}
+	values := set.Values()
+	str := "{"
+	for i, value := range values {
+		if i > 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("0x%X", value)
+	}
+	return str + "}"
+}
+
+// The values in ascending order
+func (set ValueSet) Values() []*big.Int {
+	values := make([]*big.Int, 0, len(set))
+	for _, value := range set {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Cmp(values[j]) < 0
+	})
+	return values
+}
+
+func (set ValueSet) Union(other ValueSet) ValueSet {
+	if set == nil || other == nil {
+		return nil
+	}
+	result := make(ValueSet)
+	for key, value := range set {
+		result[key] = value
+	}
+	for key, value := range other {
+		result[key] = value
+	}
+	if len(result) > MaxValueSetSize {
+		return nil
+	}
+	return result
+}
+
+func (set ValueSet) Equals(other ValueSet) bool {
+	if (set == nil) != (other == nil) || len(set) != len(other) {
+		return false
+	}
+	for key := range set {
+		if _, ok := other[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// The abstract stack at a block boundary, top of the stack first. Slots
+// deeper than the known part are unknown.
+type stackValueSets []ValueSet
+
+func (stack stackValueSets) join(other stackValueSets) stackValueSets {
+	n := len(stack)
+	if len(other) < n {
+		n = len(other)
+	}
+	result := make(stackValueSets, n)
+	for i := 0; i < n; i++ {
+		result[i] = stack[i].Union(other[i])
+	}
+	return result
+}
+
+func (stack stackValueSets) equals(other stackValueSets) bool {
+	if len(stack) != len(other) {
+		return false
+	}
+	for i := range stack {
+		if !stack[i].Equals(other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Values of the variables in a block given the stack on entry
+type valueEnvironment struct {
+	Block           *StatementBlock
+	Entry           stackValueSets
+	Variables       map[string]ValueSet
+}
+
+func newValueEnvironment(block *StatementBlock, entry stackValueSets) *valueEnvironment {
+	env := &valueEnvironment{
+		Block:     block,
+		Entry:     entry,
+		Variables: make(map[string]ValueSet),
+	}
+	
+	// The last input is the top of the stack
+	for i, input := range block.Inputs {
+		variable, ok := input.(Variable)
+		if !ok {
+			continue
+		}
+		depth := len(block.Inputs) - 1 - i
+		if depth < len(entry) {
+			env.Variables[variable.Label] = entry[depth]
+		}
+	}
+	
+	// Evaluate the statements
+	for _, statement := range block.Statements {
+		if statement.Output == nil {
+			continue
+		}
+		env.Variables[statement.Output.Label] = env.evaluate(statement)
+	}
+	return env
+}
+
+func (env *valueEnvironment) Eval(expression Expression) ValueSet {
+	switch expression := expression.(type) {
+	case Constant:
+		return NewValueSet(expression.Value)
+	case Variable:
+		return env.Variables[expression.Label]
+	}
+	return nil
+}
+
+// Applies the statement to every combination of possible input values
+func (env *valueEnvironment) evaluate(statement *Statement) ValueSet {
+	combinations := [][]*big.Int{{}}
+	for _, input := range statement.Inputs {
+		set := env.Eval(input)
+		if set == nil || len(set) * len(combinations) > MaxValueSetSize {
+			return nil
+		}
+		next := make([][]*big.Int, 0)
+		for _, combination := range combinations {
+			for _, value := range set.Values() {
+				args := append(append([]*big.Int{}, combination...), value)
+				next = append(next, args)
+			}
+		}
+		combinations = next
+	}
+	result := make(ValueSet)
+	for _, args := range combinations {
+		value, ok := Evaluate(statement.Op, args...)
+		if !ok {
+			return nil
+		}
+		result[value.Text(16)] = value
+	}
+	return result
+}
+
+// The stack on exit from the block
+func (env *valueEnvironment) Exit() stackValueSets {
+	outputs := env.Block.Outputs
+	exit := make(stackValueSets, 0)
+	for i := len(outputs) - 1; i >= 0; i-- {
+		exit = append(exit, env.Eval(outputs[i]))
+	}
+	
+	// Stack below what the block reads passes through untouched
+	if len(env.Entry) >= len(env.Block.Inputs) {
+		exit = append(exit, env.Entry[len(env.Block.Inputs):]...)
+	}
+	return exit
+}
+
+// The possible targets of the jump statements in the block
+func (env *valueEnvironment) jumpTargets(statement *Statement) ValueSet {
+	if statement.Op != JUMP && statement.Op != JUMPI {
+		return nil
+	}
+	return env.Eval(statement.Inputs[0])
+}
+
+type DynamicJump struct {
+	Block           *StatementBlock
+	Statement       *Statement
+}
+
+func (jump DynamicJump) String() string {
+	return fmt.Sprintf("%v: %v", jump.Block.Label, jump.Statement)
+}
+
+// Resolves computed jump targets by propagating the sets of possible
+// constant values on the stack through the control flow graph. Must run
+// on unmerged blocks, before CollapseJumps. Resolved targets are stored
+// in the jump statements and the control flow is updated. Returns the
+// jumps whose targets could not be resolved.
+func (ssa *SSAProgram) ResolveJumps() []DynamicJump {
+	if len(ssa.Blocks) == 0 {
+		return nil
+	}
+	
+	// Find the fixpoint of the stacks at block entry
+	states := make(map[*StatementBlock]stackValueSets)
+	entry := ssa.Blocks[0]
+	states[entry] = make(stackValueSets, 0)
+	work := []*StatementBlock{entry}
+	for len(work) > 0 {
+		block := work[len(work) - 1]
+		work = work[:len(work) - 1]
+		
+		env := newValueEnvironment(block, states[block])
+		exit := env.Exit()
+		for _, successor := range ssa.valueSuccessors(env) {
+			old, ok := states[successor]
+			state := exit
+			if ok {
+				state = old.join(exit)
+				if state.equals(old) {
+					continue
+				}
+			}
+			states[successor] = state
+			work = append(work, successor)
+		}
+	}
+	
+	// Record the resolved targets
+	dynamic := make([]DynamicJump, 0)
+	for _, block := range ssa.Blocks {
+		env := newValueEnvironment(block, states[block])
+		for _, statement := range block.Statements {
+			if statement.Op != JUMP && statement.Op != JUMPI {
+				continue
+			}
+			if _, ok := statement.Inputs[0].(Constant); ok {
+				continue
+			}
+			targets := env.jumpTargets(statement)
+			_, reached := states[block]
+			if len(targets) == 0 || !reached {
+				dynamic = append(dynamic, DynamicJump{block, statement})
+				continue
+			}
+			statement.Targets = make([]int, 0)
+			for _, target := range targets.Values() {
+				offset := -1
+				if target.IsInt64() {
+					offset = int(target.Int64())
+				}
+				statement.Targets = append(statement.Targets, offset)
+			}
+		}
+	}
+	
+	ssa.ComputeJumpTargets()
+	ssa.ComputeIncoming()
+	return dynamic
+}
+
+// The blocks control can flow to from a block, including the targets
+// of computed jumps given the values in the environment.
+func (ssa *SSAProgram) valueSuccessors(env *valueEnvironment) []*StatementBlock {
+	block := env.Block
+	successors := make([]*StatementBlock, 0)
+	if block.CanGoToNext() && block.NextBlock != nil {
+		successors = append(successors, block.NextBlock)
+	}
+	for _, statement := range block.Statements {
+		for _, target := range env.jumpTargets(statement).Values() {
+			if !target.IsInt64() || !ssa.JumpDests.IsValid(int(target.Int64())) {
+				continue
+			}
+			if successor := ssa.BlockByOffset(int(target.Int64())); successor != nil {
+				successors = append(successors, successor)
+			}
+		}
+	}
+	return successors
+}
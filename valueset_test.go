@@ -0,0 +1,228 @@
+package evmdis
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+const (
+	maxWord = "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	minWord = "8000000000000000000000000000000000000000000000000000000000000000"
+)
+
+func word(t *testing.T, str string) *big.Int {
+	value, ok := new(big.Int).SetString(str, 16)
+	if !ok {
+		t.Fatalf("invalid word %v", str)
+	}
+	return value
+}
+
+// A set of the values 0 to n - 1
+func valueRange(n int) ValueSet {
+	set := make(ValueSet)
+	for i := 0; i < n; i++ {
+		value := big.NewInt(int64(i))
+		set[value.Text(16)] = value
+	}
+	return set
+}
+
+func TestValueSetUnion(t *testing.T) {
+	one, two, three := big.NewInt(1), big.NewInt(2), big.NewInt(3)
+	tests := []struct {
+		name     string
+		set      ValueSet
+		other    ValueSet
+		expected string
+	}{
+		{"overlapping", NewValueSet(one, two), NewValueSet(two, three), "{0x1, 0x2, 0x3}"},
+		{"empty", NewValueSet(), NewValueSet(one), "{0x1}"},
+		{"unknown", nil, NewValueSet(one), "?"},
+		{"unknown other", NewValueSet(one), nil, "?"},
+		{"full", valueRange(MaxValueSetSize - 1), NewValueSet(big.NewInt(MaxValueSetSize - 1)), valueRange(MaxValueSetSize).String()},
+		// A set growing past the limit widens to unknown
+		{"overflow", valueRange(MaxValueSetSize), NewValueSet(big.NewInt(MaxValueSetSize)), "?"},
+	}
+	for _, test := range tests {
+		if str := test.set.Union(test.other).String(); str != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, str)
+		}
+	}
+}
+
+func TestValueSetEquals(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      ValueSet
+		other    ValueSet
+		expected bool
+	}{
+		{"same", NewValueSet(big.NewInt(1), big.NewInt(2)), NewValueSet(big.NewInt(2), big.NewInt(1)), true},
+		{"different", NewValueSet(big.NewInt(1)), NewValueSet(big.NewInt(2)), false},
+		{"subset", NewValueSet(big.NewInt(1)), NewValueSet(big.NewInt(1), big.NewInt(2)), false},
+		{"unknown", nil, nil, true},
+		{"unknown and empty", nil, NewValueSet(), false},
+	}
+	for _, test := range tests {
+		if test.set.Equals(test.other) != test.expected || test.other.Equals(test.set) != test.expected {
+			t.Errorf("%v: expected %v == %v to be %v", test.name, test.set, test.other, test.expected)
+		}
+	}
+}
+
+func TestStackJoin(t *testing.T) {
+	one, two, three := NewValueSet(big.NewInt(1)), NewValueSet(big.NewInt(2)), NewValueSet(big.NewInt(3))
+	tests := []struct {
+		name     string
+		stack    stackValueSets
+		other    stackValueSets
+		expected string
+	}{
+		{"same depth", stackValueSets{one, two}, stackValueSets{three, two}, "[{0x1, 0x3} {0x2}]"},
+		// Only the slots known on both paths are kept
+		{"shallower", stackValueSets{one, two}, stackValueSets{three}, "[{0x1, 0x3}]"},
+		{"empty", stackValueSets{one}, stackValueSets{}, "[]"},
+		{"unknown", stackValueSets{nil, one}, stackValueSets{two, one}, "[? {0x1}]"},
+	}
+	for _, test := range tests {
+		joined := test.stack.join(test.other)
+		strs := make([]string, len(joined))
+		for i, set := range joined {
+			strs[i] = set.String()
+		}
+		if str := "[" + strings.Join(strs, " ") + "]"; str != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, str)
+		}
+		if !joined.equals(test.other.join(test.stack)) {
+			t.Errorf("%v: the join is not symmetric", test.name)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		op       OpCode
+		args     []string
+		expected string // Empty if there is no constant result
+	}{
+		{ADD, []string{"2", "3"}, "5"},
+		{ADD, []string{maxWord, "1"}, "0"},
+		{MUL, []string{minWord, "2"}, "0"},
+		{MUL, []string{maxWord, maxWord}, "1"},
+		{SUB, []string{"0", "1"}, maxWord},
+		{SUB, []string{"5", "3"}, "2"},
+		{DIV, []string{"7", "2"}, "3"},
+		{DIV, []string{"7", "0"}, "0"},
+		{SDIV, []string{"fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff9", "2"},
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffd"},
+		{SDIV, []string{minWord, maxWord}, minWord},
+		{SDIV, []string{"7", "0"}, "0"},
+		{MOD, []string{"7", "3"}, "1"},
+		{MOD, []string{"7", "0"}, "0"},
+		{SMOD, []string{"fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff9", "3"}, maxWord},
+		{SMOD, []string{"7", "0"}, "0"},
+		// The sum and product are not reduced before the modulo
+		{ADDMOD, []string{maxWord, "2", "3"}, "2"},
+		{ADDMOD, []string{"1", "2", "0"}, "0"},
+		{MULMOD, []string{maxWord, maxWord, "7"}, "1"},
+		{MULMOD, []string{"2", "3", "0"}, "0"},
+		{EXP, []string{"3", "2"}, "9"},
+		{EXP, []string{"2", "ff"}, minWord},
+		{EXP, []string{"2", "100"}, "0"},
+		{SIGNEXTEND, []string{"0", "ff"}, maxWord},
+		{SIGNEXTEND, []string{"0", "17f"}, "7f"},
+		{SIGNEXTEND, []string{"1", "80ff"}, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff80ff"},
+		{SIGNEXTEND, []string{"1f", "ff"}, "ff"},
+		{SIGNEXTEND, []string{"10000000000000000", "ff"}, "ff"},
+		{LT, []string{"1", "2"}, "1"},
+		{LT, []string{maxWord, "0"}, "0"},
+		{GT, []string{maxWord, "0"}, "1"},
+		{SLT, []string{maxWord, "0"}, "1"},
+		{SGT, []string{maxWord, "0"}, "0"},
+		{SGT, []string{"0", minWord}, "1"},
+		{EQ, []string{"2", "2"}, "1"},
+		{EQ, []string{"2", "3"}, "0"},
+		{ISZERO, []string{"0"}, "1"},
+		{ISZERO, []string{minWord}, "0"},
+		{AND, []string{"ff0", "f0f"}, "f00"},
+		{OR, []string{"ff0", "f0f"}, "fff"},
+		{XOR, []string{"ff0", "f0f"}, "ff"},
+		{NOT, []string{"0"}, maxWord},
+		{NOT, []string{maxWord}, "0"},
+		{BYTE, []string{"1f", "1234"}, "34"},
+		{BYTE, []string{"1e", "1234"}, "12"},
+		{BYTE, []string{"0", minWord}, "80"},
+		{BYTE, []string{"20", maxWord}, "0"},
+		{BYTE, []string{"10000000000000000", maxWord}, "0"},
+		{SHL, []string{"1", maxWord}, "fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"},
+		{SHL, []string{"ff", "1"}, minWord},
+		{SHL, []string{"100", "1"}, "0"},
+		{SHR, []string{"4", "10"}, "1"},
+		{SHR, []string{"ff", maxWord}, "1"},
+		{SHR, []string{"100", maxWord}, "0"},
+		{SAR, []string{"4", minWord}, "f800000000000000000000000000000000000000000000000000000000000000"},
+		{SAR, []string{"4", "100"}, "10"},
+		{SAR, []string{"100", minWord}, maxWord},
+		{SAR, []string{"100", "1"}, "0"},
+		{SAR, []string{"10000000000000000", maxWord}, maxWord},
+		{SLOAD, []string{"0"}, ""},
+		{CALLDATALOAD, []string{"0"}, ""},
+		{ADD, []string{"1"}, ""},
+	}
+	for _, test := range tests {
+		args := make([]*big.Int, len(test.args))
+		for i, arg := range test.args {
+			args[i] = word(t, arg)
+		}
+		value, ok := Evaluate(test.op, args...)
+		switch {
+		case test.expected == "" && ok:
+			t.Errorf("%v%v: expected no result, got %x", test.op, test.args, value)
+		case test.expected != "" && !ok:
+			t.Errorf("%v%v: expected %v, got no result", test.op, test.args, test.expected)
+		case ok && value.Cmp(word(t, test.expected)) != 0:
+			t.Errorf("%v%v: expected %v, got %x", test.op, test.args, test.expected, value)
+		}
+	}
+}
+
+func TestEvaluateSets(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        ValueSet
+		b        ValueSet
+		expected string
+	}{
+		{"combinations", NewValueSet(big.NewInt(1), big.NewInt(2)), NewValueSet(big.NewInt(0x10), big.NewInt(0x20)),
+			"{0x11, 0x12, 0x21, 0x22}"},
+		{"wrap-around", NewValueSet(word(t, maxWord)), NewValueSet(big.NewInt(1), big.NewInt(2)), "{0x0, 0x1}"},
+		{"unknown", nil, NewValueSet(big.NewInt(1)), "?"},
+		// More combinations than a set holds widen to unknown
+		{"overflow", valueRange(6), valueRange(6), "?"},
+	}
+	for _, test := range tests {
+		env := &valueEnvironment{Variables: map[string]ValueSet{"a": test.a, "b": test.b}}
+		statement := &Statement{Op: ADD, Inputs: []Expression{Variable{Label: "a"}, Variable{Label: "b"}}}
+		if str := env.evaluate(statement).String(); str != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, str)
+		}
+	}
+}
+
+func TestResolveJumpsWidening(t *testing.T) {
+	// The return address 0xE stays below a counter that grows on every
+	// iteration of the loop until its set is unknown
+	ssa := compileSSA(t, "600e6000" + "5b600101346004575056" + "5b00")
+	if dynamic := ssa.ResolveJumps(); len(dynamic) != 0 {
+		t.Fatalf("expected every jump to be resolved, got %v", dynamic)
+	}
+	for _, block := range ssa.Blocks {
+		for _, statement := range block.Statements {
+			if statement.Op == JUMP && (len(statement.Targets) != 1 || statement.Targets[0] != 0xe) {
+				t.Errorf("expected a jump to 0xE, got %v", statement.Targets)
+			}
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package evmdis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Builtins whose name is not the lowercase opcode name
+var yulNames = map[OpCode]string{
+	SHA3:       "keccak256",
+	GASPRICE:   "gasprice",
+}
+
+// From Paris on DIFFICULTY is only available as prevrandao
+func yulName(op OpCode, fork Fork) string {
+	if op == DIFFICULTY && fork >= Paris {
+		return "prevrandao"
+	}
+	if name, ok := yulNames[op]; ok {
+		return name
+	}
+	return strings.ToLower(op.String())
+}
+
+func (w *yulWriter) call(op OpCode, inputs []Expression) string {
+	arguments := make([]string, len(inputs))
+	for i, input := range inputs {
+		arguments[i] = w.expression(input)
+	}
+	return fmt.Sprintf("%v(%v)", yulName(op, w.ssa.Fork), strings.Join(arguments, ", "))
+}
+
+// Writes an expression with Yul builtins. Casts become the masks and sign
+// extensions they were recovered from.
+func (w *yulWriter) expression(expression Expression) string {
+	switch expression := expression.(type) {
+	case Constant:
+		return fmt.Sprintf("0x%x", expression.Value)
+	case Variable:
+		return expression.Label
+	case *Operation:
+		return w.call(expression.Op, expression.Inputs)
+	case *Cast:
+		value := w.expression(expression.Value)
+		var bits int
+		switch {
+		case expression.Type == "bool":
+			return fmt.Sprintf("iszero(iszero(%v))", value)
+		case expression.Type == "address":
+			bits = 160
+		case strings.HasPrefix(expression.Type, "uint"):
+			fmt.Sscanf(expression.Type, "uint%d", &bits)
+		case strings.HasPrefix(expression.Type, "int"):
+			fmt.Sscanf(expression.Type, "int%d", &bits)
+			return fmt.Sprintf("signextend(%v, %v)", bits / 8 - 1, value)
+		}
+		return fmt.Sprintf("and(%v, 0x%x)", value, lowMask(uint(bits)))
+	case *Randomness:
+		return "prevrandao()"
+	}
+	return fmt.Sprintf("%v", expression)
+}
+
+// Collects the variables used by an expression
+func yulVariables(expression Expression, variables map[string]bool) {
+	switch expression := expression.(type) {
+	case Variable:
+		variables[expression.Label] = true
+	case *Operation:
+		for _, input := range expression.Inputs {
+			yulVariables(input, variables)
+		}
+	case *Cast:
+		yulVariables(expression.Value, variables)
+	}
+}
+
+// Writes the blocks of one function. Control flow that Yul has no
+// statement for is kept by looping over a switch on the offset of the
+// next block.
+type yulWriter struct {
+	ssa             *SSAProgram
+	function        *InternalFunction        // Nil for the main code
+	blocks          []*StatementBlock
+	declared        map[string]bool          // Variables that live across blocks
+	aborts          map[*StatementBlock]bool // Blocks that read a value nothing provides
+	results         []string
+}
+
+const yulDestination = "destination"
+
+func (ssa *SSAProgram) newYulWriter(blocks []*StatementBlock, function *InternalFunction) *yulWriter {
+	w := &yulWriter{
+		ssa:      ssa,
+		function: function,
+		blocks:   blocks,
+		declared: make(map[string]bool),
+		aborts:   make(map[*StatementBlock]bool),
+	}
+	if function != nil {
+		for i := 0; i < function.Results; i++ {
+			w.results = append(w.results, fmt.Sprintf("r%v", i))
+		}
+	}
+	
+	// Variables used outside the block that defines them are declared
+	// before the loop, as are block inputs and phi nodes
+	definitions := make(map[string]*StatementBlock)
+	for _, block := range blocks {
+		for _, statement := range block.Statements {
+			if statement.Output != nil {
+				definitions[statement.Output.Label] = block
+			}
+		}
+	}
+	parameters := make(map[string]bool)
+	for _, parameter := range w.parameters() {
+		parameters[parameter] = true
+	}
+	connected := make(map[string]bool)
+	for variable := range parameters {
+		connected[variable] = true
+	}
+	reads := make(map[*StatementBlock]map[string]bool)
+	use := func(expression Expression, block *StatementBlock) {
+		variables := make(map[string]bool)
+		yulVariables(expression, variables)
+		if reads[block] == nil {
+			reads[block] = make(map[string]bool)
+		}
+		for variable := range variables {
+			reads[block][variable] = true
+			if definitions[variable] != block && !parameters[variable] {
+				w.declared[variable] = true
+			}
+		}
+	}
+	for _, block := range blocks {
+		for _, phi := range block.Phis {
+			w.declared[phi.Output.Label] = true
+			connected[phi.Output.Label] = true
+			for i, input := range phi.Inputs {
+				use(input, phi.Blocks[i])
+			}
+		}
+		call, isCall := ssa.Calls[block]
+		isReturn := function != nil && ssa.isFunctionReturn(block)
+		for i, statement := range block.Statements {
+			if statement.Output != nil {
+				connected[statement.Output.Label] = true
+			}
+			// The jump of a call or a return is not written
+			if statement.Op == JUMP && i == len(block.Statements) - 1 && (isCall || isReturn) {
+				continue
+			}
+			for _, input := range statement.Inputs {
+				use(input, block)
+			}
+		}
+		if isCall {
+			for _, argument := range call.Arguments {
+				use(argument, block)
+			}
+			for _, result := range call.Results() {
+				use(result, nil)
+				connected[expressionKey(result)] = true
+			}
+		}
+		if isReturn {
+			for _, output := range w.returnValues(block) {
+				use(output, block)
+			}
+		}
+	}
+	
+	// Inputs that no predecessor provides a value for would read as zero.
+	// They underflow the stack or flow in on paths that were not
+	// recovered, the blocks that read them abort instead.
+	for block, variables := range reads {
+		for variable := range variables {
+			if w.declared[variable] && !connected[variable] {
+				w.aborts[block] = true
+			}
+		}
+	}
+	return w
+}
+
+// The arguments of the function, the top inputs of the entry block
+func (w *yulWriter) parameters() []string {
+	parameters := make([]string, 0)
+	if w.function == nil {
+		return parameters
+	}
+	inputs := w.function.Entry.Inputs
+	for i := 0; i < w.function.Arguments; i++ {
+		if j := len(inputs) - w.function.Arguments + i; j >= 0 {
+			parameters = append(parameters, w.expression(inputs[j]))
+		} else {
+			parameters = append(parameters, fmt.Sprintf("arg%v", i))
+		}
+	}
+	return parameters
+}
+
+func (w *yulWriter) returnValues(block *StatementBlock) []Expression {
+	n := len(w.results)
+	if n > len(block.Outputs) {
+		n = len(block.Outputs)
+	}
+	return block.Outputs[len(block.Outputs) - n:]
+}
+
+func (w *yulWriter) assign(variable string, value string, indent string) string {
+	if w.declared[variable] {
+		return fmt.Sprintf("%v%v := %v\n", indent, variable, value)
+	}
+	return fmt.Sprintf("%vlet %v := %v\n", indent, variable, value)
+}
+
+// Assigns the values the phi nodes of the target select for the edge.
+// Phi nodes read each other's old values, so those are copied first.
+func (w *yulWriter) move(from *StatementBlock, to *StatementBlock, indent string) string {
+	outputs := make(map[string]bool)
+	for _, phi := range to.Phis {
+		outputs[phi.Output.Label] = true
+	}
+	type copy struct {
+		output          string
+		value           string
+	}
+	copies := make([]copy, 0)
+	temporaries := false
+	for _, phi := range to.Phis {
+		for i, source := range phi.Blocks {
+			if source != from || expressionKey(phi.Inputs[i]) == phi.Output.Label {
+				continue
+			}
+			variables := make(map[string]bool)
+			yulVariables(phi.Inputs[i], variables)
+			for variable := range variables {
+				temporaries = temporaries || outputs[variable]
+			}
+			copies = append(copies, copy{phi.Output.Label, w.expression(phi.Inputs[i])})
+		}
+	}
+	str := ""
+	if temporaries {
+		for _, c := range copies {
+			str += fmt.Sprintf("%vlet t_%v := %v\n", indent, c.output, c.value)
+		}
+		for _, c := range copies {
+			str += fmt.Sprintf("%v%v := t_%v\n", indent, c.output, c.output)
+		}
+		return str
+	}
+	for _, c := range copies {
+		str += fmt.Sprintf("%v%v := %v\n", indent, c.output, c.value)
+	}
+	return str
+}
+
+// Continues at the target of a jump. Computed jumps select the block at
+// run time, jumps to invalid destinations abort.
+func (w *yulWriter) jump(from *StatementBlock, target Expression, targets []*StatementBlock, indent string) string {
+	if _, ok := target.(Constant); ok || target == nil {
+		if len(targets) == 0 || targets[0] == nil || targets[0] == w.ssa.ErrorBlock {
+			return indent + "invalid()\n"
+		}
+		return w.move(from, targets[0], indent) +
+			fmt.Sprintf("%v%v := 0x%x\n", indent, yulDestination, targets[0].Offset)
+	}
+	str := ""
+	for _, block := range targets {
+		if block == nil || block == w.ssa.ErrorBlock {
+			continue
+		}
+		if moves := w.move(from, block, indent + "\t"); moves != "" {
+			str += fmt.Sprintf("%vcase 0x%x {\n%v%v}\n", indent, block.Offset, moves, indent)
+		}
+	}
+	if str != "" {
+		str = fmt.Sprintf("%vswitch %v\n%v%vdefault {}\n", indent, w.expression(target), str, indent)
+	}
+	return str + fmt.Sprintf("%v%v := %v\n", indent, yulDestination, w.expression(target))
+}
+
+func (w *yulWriter) block(block *StatementBlock, indent string) string {
+	if w.aborts[block] {
+		return indent + "invalid()\n"
+	}
+	str := ""
+	call, isCall := w.ssa.Calls[block]
+	isReturn := w.function != nil && w.ssa.isFunctionReturn(block)
+	n := len(block.Statements)
+	condition := 0
+	for i, statement := range block.Statements {
+		last := i == n - 1
+		switch {
+		case statement.Op == JUMPDEST:
+		case statement.Op == JUMPI:
+			targets := make([]*StatementBlock, 0)
+			if condition < len(block.CondBlocks) {
+				targets = append(targets, block.CondBlocks[condition])
+			}
+			if _, ok := statement.Inputs[0].(Constant); !ok {
+				targets = append(targets, block.JumpTargets...)
+			}
+			condition++
+			str += fmt.Sprintf("%vif %v {\n%v%v\tcontinue\n%v}\n", indent,
+				w.expression(statement.Inputs[1]),
+				w.jump(block, statement.Inputs[0], targets, indent + "\t"), indent, indent)
+		case statement.Op == JUMP && last:
+			// Written below
+		case statement.Output != nil:
+			str += w.assign(statement.Output.Label, w.call(statement.Op, statement.Inputs), indent)
+		default:
+			str += fmt.Sprintf("%v%v\n", indent, w.call(statement.Op, statement.Inputs))
+		}
+	}
+	
+	switch {
+	case isCall:
+		arguments := make([]string, len(call.Arguments))
+		for i, argument := range call.Arguments {
+			arguments[i] = w.expression(argument)
+		}
+		results := make([]string, 0)
+		for _, result := range call.Results() {
+			results = append(results, w.expression(result))
+		}
+		invocation := fmt.Sprintf("%v(%v)", call.Function.Label, strings.Join(arguments, ", "))
+		if len(results) > 0 {
+			str += fmt.Sprintf("%v%v := %v\n", indent, strings.Join(results, ", "), invocation)
+		} else {
+			str += fmt.Sprintf("%v%v\n", indent, invocation)
+		}
+		str += w.jump(block, nil, []*StatementBlock{call.Continuation}, indent)
+	case isReturn:
+		for i, output := range w.returnValues(block) {
+			str += fmt.Sprintf("%v%v := %v\n", indent, w.results[i], w.expression(output))
+		}
+		str += indent + "leave\n"
+	case n > 0 && block.Statements[n - 1].Op == JUMP:
+		targets := make([]*StatementBlock, 0)
+		if block.NextBlock != nil {
+			targets = append(targets, block.NextBlock)
+		}
+		targets = append(targets, block.JumpTargets...)
+		str += w.jump(block, block.Statements[n - 1].Inputs[0], targets, indent)
+	case n > 0 && block.Statements[n - 1].Op.IsControlFlow():
+	case block.NextBlock != nil:
+		str += w.jump(block, nil, []*StatementBlock{block.NextBlock}, indent)
+	default:
+		// Running off the end of the code stops
+		str += indent + "stop()\n"
+	}
+	return str
+}
+
+// Writes the blocks as a loop over a switch, starting at the entry
+func (w *yulWriter) body(entry *StatementBlock, indent string) string {
+	str := ""
+	declared := make([]string, 0, len(w.declared))
+	for variable := range w.declared {
+		declared = append(declared, variable)
+	}
+	sort.Strings(declared)
+	if len(declared) > 0 {
+		str += fmt.Sprintf("%vlet %v\n", indent, strings.Join(declared, ", "))
+	}
+	str += fmt.Sprintf("%vlet %v := 0x%x\n", indent, yulDestination, entry.Offset)
+	str += fmt.Sprintf("%vfor {} 1 {} {\n", indent)
+	str += fmt.Sprintf("%v\tswitch %v\n", indent, yulDestination)
+	for _, block := range w.blocks {
+		if block == w.ssa.ErrorBlock {
+			continue
+		}
+		str += fmt.Sprintf("%v\tcase 0x%x { // %v\n", indent, block.Offset, block.Label)
+		str += w.block(block, indent + "\t\t")
+		str += fmt.Sprintf("%v\t}\n", indent)
+	}
+	str += fmt.Sprintf("%v\tdefault {\n%v\t\tinvalid()\n%v\t}\n", indent, indent, indent)
+	str += fmt.Sprintf("%v}\n", indent)
+	return str
+}
+
+func (ssa *SSAProgram) regionBlocks(entry *StatementBlock) []*StatementBlock {
+	blocks := make([]*StatementBlock, 0)
+	for _, node := range ssa.functionCFG(entry).Nodes {
+		blocks = append(blocks, node.(*StatementBlock))
+	}
+	return blocks
+}
+
+func sortBlocks(blocks []*StatementBlock) {
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Offset < blocks[j].Offset
+	})
+}
+
+// Writes the program as a Yul object that solc --strict-assembly accepts.
+// Every block is a case of a switch in a loop, internal functions become
+// Yul functions. Must run on the program before the public functions are
+// labelled, the boilerplate they strip is needed to recompile.
+func (ssa *SSAProgram) Yul() string {
+	str := "object \"Decompiled\" {\n\tcode {\n"
+	if len(ssa.Blocks) == 0 {
+		return str + "\t}\n}\n"
+	}
+	
+	// The main code is every block that is not part of a function
+	inFunction := make(map[*StatementBlock]bool)
+	regions := make(map[*InternalFunction][]*StatementBlock)
+	for _, function := range ssa.Functions {
+		regions[function] = ssa.regionBlocks(function.Entry)
+		for _, block := range regions[function] {
+			inFunction[block] = true
+		}
+	}
+	main := ssa.regionBlocks(ssa.Blocks[0])
+	reached := make(map[*StatementBlock]bool)
+	for _, block := range main {
+		reached[block] = true
+	}
+	for _, block := range ssa.Blocks {
+		if !reached[block] && !inFunction[block] {
+			main = append(main, block)
+		}
+	}
+	sortBlocks(main)
+	str += ssa.newYulWriter(main, nil).body(ssa.Blocks[0], "\t\t")
+	
+	for _, function := range ssa.Functions {
+		blocks := regions[function]
+		sortBlocks(blocks)
+		w := ssa.newYulWriter(blocks, function)
+		str += fmt.Sprintf("\n\t\tfunction %v(%v)", function.Label, strings.Join(w.parameters(), ", "))
+		if len(w.results) > 0 {
+			str += fmt.Sprintf(" -> %v", strings.Join(w.results, ", "))
+		}
+		str += " {\n"
+		str += w.body(function.Entry, "\t\t\t")
+		str += "\t\t}\n"
+	}
+	return str + "\t}\n}\n"
+}
@@ -0,0 +1,157 @@
+package evmdis
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Runs the passes of the decompiler the way they run for Yul output
+func decompileYul(t *testing.T, code string, fork Fork) string {
+	bytecode, err := hex.DecodeString(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssa := CompileSSA(NewProgram(bytecode, fork))
+	ssa.ComputeJumpTargets()
+	ssa.ComputeIncoming()
+	ssa.ResolveJumps()
+	ssa.CollapseJumps()
+	ssa.RecoverFunctions()
+	ssa.ConstructSSA()
+	ssa.Simplify()
+	ssa.DecodeReturns()
+	ssa.InferArgumentTypes()
+	ssa.EliminateDeadCode()
+	ssa.FoldExpressions()
+	return ssa.Yul()
+}
+
+func TestYulNames(t *testing.T) {
+	tests := map[OpCode]string{
+		STOP:           "stop",
+		ADD:            "add",
+		MUL:            "mul",
+		SUB:            "sub",
+		DIV:            "div",
+		SDIV:           "sdiv",
+		MOD:            "mod",
+		SMOD:           "smod",
+		ADDMOD:         "addmod",
+		MULMOD:         "mulmod",
+		EXP:            "exp",
+		SIGNEXTEND:     "signextend",
+		LT:             "lt",
+		GT:             "gt",
+		SLT:            "slt",
+		SGT:            "sgt",
+		EQ:             "eq",
+		ISZERO:         "iszero",
+		AND:            "and",
+		OR:             "or",
+		XOR:            "xor",
+		NOT:            "not",
+		BYTE:           "byte",
+		SHL:            "shl",
+		SHR:            "shr",
+		SAR:            "sar",
+		SHA3:           "keccak256",
+		ADDRESS:        "address",
+		BALANCE:        "balance",
+		ORIGIN:         "origin",
+		CALLER:         "caller",
+		CALLVALUE:      "callvalue",
+		CALLDATALOAD:   "calldataload",
+		CALLDATASIZE:   "calldatasize",
+		CALLDATACOPY:   "calldatacopy",
+		CODESIZE:       "codesize",
+		CODECOPY:       "codecopy",
+		GASPRICE:       "gasprice",
+		EXTCODESIZE:    "extcodesize",
+		EXTCODECOPY:    "extcodecopy",
+		RETURNDATASIZE: "returndatasize",
+		RETURNDATACOPY: "returndatacopy",
+		EXTCODEHASH:    "extcodehash",
+		BLOCKHASH:      "blockhash",
+		COINBASE:       "coinbase",
+		TIMESTAMP:      "timestamp",
+		NUMBER:         "number",
+		DIFFICULTY:     "prevrandao",
+		GASLIMIT:       "gaslimit",
+		CHAINID:        "chainid",
+		SELFBALANCE:    "selfbalance",
+		BASEFEE:        "basefee",
+		BLOBHASH:       "blobhash",
+		BLOBBASEFEE:    "blobbasefee",
+		MLOAD:          "mload",
+		MSTORE:         "mstore",
+		MSTORE8:        "mstore8",
+		SLOAD:          "sload",
+		SSTORE:         "sstore",
+		JUMP:           "jump",
+		JUMPI:          "jumpi",
+		MSIZE:          "msize",
+		GAS:            "gas",
+		TLOAD:          "tload",
+		TSTORE:         "tstore",
+		MCOPY:          "mcopy",
+		LOG0:           "log0",
+		LOG1:           "log1",
+		LOG2:           "log2",
+		LOG3:           "log3",
+		LOG4:           "log4",
+		CREATE:         "create",
+		CALL:           "call",
+		CALLCODE:       "callcode",
+		RETURN:         "return",
+		DELEGATECALL:   "delegatecall",
+		CREATE2:        "create2",
+		STATICCALL:     "staticcall",
+		REVERT:         "revert",
+		INVALID:        "invalid",
+		SELFDESTRUCT:   "selfdestruct",
+	}
+	ops := make(map[string]OpCode)
+	for op := range opCodeInfo {
+		name := yulName(op, LatestFork)
+		if expected, ok := tests[op]; !ok || name != expected {
+			t.Errorf("%v: expected %q, got %q", op, expected, name)
+		}
+		if other, ok := ops[name]; ok {
+			t.Errorf("%v and %v are both %q", op, other, name)
+		}
+		ops[name] = op
+	}
+	for op := range tests {
+		if _, ok := opCodeInfo[op]; !ok {
+			t.Errorf("%v is not rendered", op)
+		}
+	}
+}
+
+func TestYulDifficulty(t *testing.T) {
+	// s[0] = block.difficulty
+	code := "4460005500"
+	if yul := decompileYul(t, code, London); !strings.Contains(yul, "sstore(0x0, difficulty())") {
+		t.Errorf("expected difficulty before Paris, got\n%v", yul)
+	}
+	if yul := decompileYul(t, code, Paris); !strings.Contains(yul, "sstore(0x0, prevrandao())") {
+		t.Errorf("expected prevrandao from Paris on, got\n%v", yul)
+	}
+}
+
+func TestYulProgramCounter(t *testing.T) {
+	// s[0] = pc
+	yul := decompileYul(t, "60015058600055" + "00", LatestFork)
+	if strings.Contains(yul, "pc()") || !strings.Contains(yul, "sstore(0x0, 0x3)") {
+		t.Errorf("expected the offset of the instruction, got\n%v", yul)
+	}
+}
+
+func TestYulUnconnectedInput(t *testing.T) {
+	// s[0] = value below an empty stack
+	yul := decompileYul(t, "60005500", LatestFork)
+	if strings.Contains(yul, "sstore") || !strings.Contains(yul, "invalid()") {
+		t.Errorf("expected the block to abort, got\n%v", yul)
+	}
+}